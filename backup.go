@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// affectedPrefixes returns the sorted, unique top-level segments of the given keys
+func affectedPrefixes(pairs []KVPair) []string {
+	seen := make(map[string]bool)
+	prefixes := make([]string, 0)
+
+	for _, pair := range pairs {
+		prefix, _, _ := strings.Cut(pair.Key, "/")
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// fetchKeySpace reads all keys stored in Consul under the top-level prefixes of the given pairs
+func fetchKeySpace(ctx context.Context, client *ConsulClient, pairs []KVPair) ([]KVPair, error) {
+	var existing []KVPair
+
+	for _, prefix := range affectedPrefixes(pairs) {
+		entries, err := client.listKeys(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys under '%s': %w", prefix, err)
+		}
+
+		decoded, err := decodeKVData(entries)
+		if err != nil {
+			return nil, err
+		}
+
+		existing = append(existing, keysUnderPrefix(decoded, prefix)...)
+	}
+
+	return existing, nil
+}
+
+// keysUnderPrefix returns the pairs stored at prefix or below it. A recursive read of "app"
+// also matches "application/...", which is not part of the app key space
+func keysUnderPrefix(pairs []KVPair, prefix string) []KVPair {
+	if prefix == "" {
+		return pairs
+	}
+
+	var filtered []KVPair
+	for _, pair := range pairs {
+		if pair.Key == prefix || strings.HasPrefix(pair.Key, prefix+"/") {
+			filtered = append(filtered, pair)
+		}
+	}
+
+	return filtered
+}
+
+// decodeKVData converts KV entries read from Consul into KV pairs with decoded values
+func decodeKVData(entries []KVData) ([]KVPair, error) {
+	pairs := make([]KVPair, len(entries))
+
+	for i, entry := range entries {
+		value, err := base64.StdEncoding.DecodeString(entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode value of key '%s': %w", entry.Key, err)
+		}
+		pairs[i] = KVPair{Key: entry.Key, Value: string(value), Flags: entry.Flags}
+	}
+
+	return pairs, nil
+}
+
+// backupKeySpace writes the existing contents of the affected key space to a
+// timestamped file in dir and returns the path of that file
+func backupKeySpace(existing []KVPair, dir, name string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	timestamp := time.Now().UTC().Format("20060102T150405Z")
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", name, timestamp))
+
+	// Backups contain live values, so keep them private to the current user
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer file.Close()
+
+	if err := writeConsulJSON(file, existing); err != nil {
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write backup file: %w", err)
+	}
+
+	return path, nil
+}
+
+// backupName returns the name used as the prefix of backup files
+func backupName(opts Options) string {
+	if opts.Environment != "" {
+		return opts.Environment
+	}
+	return "restore"
+}
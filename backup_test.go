@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAffectedPrefixes(t *testing.T) {
+	pairs := []KVPair{
+		{Key: "database/primary/host"},
+		{Key: "app/name"},
+		{Key: "database/primary/port"},
+		{Key: "standalone"},
+	}
+
+	expected := []string{"app", "database", "standalone"}
+	if result := affectedPrefixes(pairs); !reflect.DeepEqual(result, expected) {
+		t.Errorf("affectedPrefixes() = %v, want %v", result, expected)
+	}
+}
+
+func TestBackupAndRestoreRoundTrip(t *testing.T) {
+	_, server := newFakeConsul(t, map[string]string{
+		"app/name":         "myapp",
+		"app/port":         "8080",
+		"application/name": "unrelated",
+		"other/key":        "untouched",
+	})
+	client := NewConsulClient(server.URL, DefaultDatacenter)
+
+	dir := t.TempDir()
+	pairs := []KVPair{{Key: "app/name", Value: "newapp"}}
+
+	existing, err := fetchKeySpace(context.Background(), client, pairs)
+	if err != nil {
+		t.Fatalf("fetchKeySpace() error = %v", err)
+	}
+
+	path, err := backupKeySpace(existing, dir, "production")
+	if err != nil {
+		t.Fatalf("backupKeySpace() error = %v", err)
+	}
+
+	if !strings.HasPrefix(filepath.Base(path), "production-") {
+		t.Errorf("backup file name = %s, want production- prefix", filepath.Base(path))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("backup file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	restored, err := readImportFile(path)
+	if err != nil {
+		t.Fatalf("readImportFile() error = %v", err)
+	}
+
+	expected := []KVPair{
+		{Key: "app/name", Value: "myapp", File: path},
+		{Key: "app/port", Value: "8080", File: path},
+	}
+	if !reflect.DeepEqual(restored, expected) {
+		t.Errorf("restored pairs = %v, want %v", restored, expected)
+	}
+}
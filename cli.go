@@ -0,0 +1,496 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3"
+var version = ""
+
+// cliSettings collects the options and logging settings given on the command line
+type cliSettings struct {
+	Options
+	logFormat string
+	logLevel  string
+	verbose   bool
+	timeout   time.Duration
+}
+
+// command is a subcommand of the command line
+type command struct {
+	name    string
+	aliases []string
+	args    string // synopsis of the positional arguments
+	summary string
+	flags   []func(fs *flag.FlagSet, s *cliSettings)
+
+	// prepare applies the positional arguments and the mode of the command to the settings
+	prepare func(s *cliSettings, args []string) error
+
+	// run replaces the sync pipeline for commands that neither load files nor contact Consul
+	run func(s *cliSettings, stdout io.Writer) error
+}
+
+// commands lists the subcommands in the order they are shown in the usage
+var commands = []*command{
+	{
+		name:    "sync",
+		args:    "<environment>",
+		summary: "Sync the files of an environment to Consul",
+		flags:   []func(*flag.FlagSet, *cliSettings){environmentFlags, loadFlags, interpolateFlags, consulFlags, writeFlags, reportFlag, logFlags},
+		prepare: environmentArg,
+	},
+	{
+		name:    "plan",
+		args:    "<environment>",
+		summary: "Show the keys a sync would write, without contacting Consul",
+		flags:   []func(*flag.FlagSet, *cliSettings){environmentFlags, loadFlags, interpolateFlags, reportFlag, logFlags},
+		prepare: func(s *cliSettings, args []string) error {
+			s.DryRun = true
+			return environmentArg(s, args)
+		},
+	},
+	{
+		name:    "validate",
+		args:    "<environment>",
+		summary: "Check the files of an environment for duplicate, invalid and disallowed keys, schema violations and value sizes",
+		flags:   []func(*flag.FlagSet, *cliSettings){environmentFlags, loadFlags, reportFlag, logFlags},
+		prepare: func(s *cliSettings, args []string) error {
+			s.Validate = true
+			return environmentArg(s, args)
+		},
+	},
+	{
+		name:    "export",
+		args:    "<environment>",
+		summary: "Write the keys of an environment to stdout in Consul JSON format",
+		flags:   []func(*flag.FlagSet, *cliSettings){environmentFlags, loadFlags, interpolateFlags, logFlags},
+		prepare: func(s *cliSettings, args []string) error {
+			s.Export = true
+			return environmentArg(s, args)
+		},
+	},
+	{
+		name:    "diff",
+		aliases: []string{"check"},
+		args:    "<environment>",
+		summary: "Compare Consul with the files of an environment; exit with status 2 on drift",
+		flags: []func(*flag.FlagSet, *cliSettings){environmentFlags, loadFlags, interpolateFlags, consulFlags, reportFlag, logFlags,
+			func(fs *flag.FlagSet, s *cliSettings) {
+				fs.BoolVar(&s.CheckExtra, "extra", false, "Also report keys that exist in Consul but not in the files")
+			},
+		},
+		prepare: func(s *cliSettings, args []string) error {
+			s.Check = true
+			return environmentArg(s, args)
+		},
+	},
+	{
+		name:    "import",
+		args:    "<file|->",
+		summary: "Write the keys of a Consul JSON export file or stdin to Consul",
+		flags:   []func(*flag.FlagSet, *cliSettings){consulFlags, writeFlags, reportFlag, logFlags},
+		prepare: func(s *cliSettings, args []string) error {
+			return singleArg(args, "an export file ('-' for stdin)", &s.Import)
+		},
+	},
+	{
+		name:    "restore",
+		args:    "<file>",
+		summary: "Write the keys of a backup file to Consul",
+		flags:   []func(*flag.FlagSet, *cliSettings){consulFlags, writeFlags, reportFlag, logFlags},
+		prepare: func(s *cliSettings, args []string) error {
+			return singleArg(args, "a backup file", &s.Restore)
+		},
+	},
+	{
+		name:    "pull",
+		args:    "<prefix>",
+		summary: "Generate YAML files from the keys under a Consul prefix ('/' for all keys)",
+		flags: []func(*flag.FlagSet, *cliSettings){environmentFlags, consulFlags, logFlags,
+			func(fs *flag.FlagSet, s *cliSettings) {
+				fs.StringVar(&s.PullDir, "dir", s.PullDir, "Directory to write the generated files to")
+				fs.BoolVar(&s.Split, "split", false, "Write one file per top-level key")
+			},
+		},
+		prepare: func(s *cliSettings, args []string) error {
+			return singleArg(args, "a prefix", &s.Pull)
+		},
+	},
+	{
+		name:    "envs",
+		summary: "List the environments of the configuration file",
+		flags: []func(*flag.FlagSet, *cliSettings){
+			func(fs *flag.FlagSet, s *cliSettings) {
+				fs.StringVar(&s.ConfigFile, "config", s.ConfigFile, "Path to environments configuration file")
+			},
+		},
+		prepare: noArgs,
+		run:     listEnvironments,
+	},
+	{
+		name:    "version",
+		summary: "Print the version",
+		prepare: noArgs,
+		run: func(s *cliSettings, stdout io.Writer) error {
+			_, err := fmt.Fprintf(stdout, "%s %s\n", programName(), versionString())
+			return err
+		},
+	},
+}
+
+func environmentFlags(fs *flag.FlagSet, s *cliSettings) {
+	fs.StringVar(&s.Environment, "env", s.Environment, "Environment name")
+	fs.StringVar(&s.ConfigFile, "config", s.ConfigFile, "Path to environments configuration file")
+}
+
+func loadFlags(fs *flag.FlagSet, s *cliSettings) {
+	fs.BoolVar(&s.MultiDoc, "multi-doc", s.MultiDoc, "Load every document of multi-document YAML files; when false such files are an error")
+	fs.IntVar(&s.MaxSize, "max-value-size", s.MaxSize, "Largest value in bytes to accept; Consul rejects values above its kv_max_value_size (0 disables the check)")
+	fs.BoolVar(&s.Strict, "strict", s.Strict, "Fail on undefined -interpolate and template variables instead of replacing them with an empty string, and on YAML map keys that are not strings")
+}
+
+func interpolateFlags(fs *flag.FlagSet, s *cliSettings) {
+	fs.BoolVar(&s.Interpolate, "interpolate", s.Interpolate, "Resolve ${VAR}, ${VAR:-default} and ${file:path} references in values")
+}
+
+func consulFlags(fs *flag.FlagSet, s *cliSettings) {
+	fs.StringVar(&s.ConsulAddr, "consul-addr", s.ConsulAddr, "Consul HTTP API address")
+	fs.StringVar(&s.Datacenter, "datacenter", s.Datacenter, "Consul datacenter")
+	fs.DurationVar(&s.timeout, "timeout", s.timeout, "Overall deadline for the run, e.g. 2m (0 means no deadline)")
+}
+
+func writeFlags(fs *flag.FlagSet, s *cliSettings) {
+	fs.BoolVar(&s.DryRun, "dry-run", s.DryRun, "Perform a dry run without making actual changes")
+	fs.BoolVar(&s.Backup, "backup", s.Backup, "Back up existing keys under the affected prefixes before syncing")
+	fs.StringVar(&s.BackupDir, "backup-dir", s.BackupDir, "Directory to write backup files to")
+	fs.StringVar(&s.Output, "output", s.Output, "Format of the sync result: text or json")
+}
+
+// reportFlag registers the repeatable -report flag
+func reportFlag(fs *flag.FlagSet, s *cliSettings) {
+	fs.Var((*reportFlags)(&s.Reports), "report", "Write a CI report: junit=<path> or github (repeatable)")
+}
+
+func logFlags(fs *flag.FlagSet, s *cliSettings) {
+	fs.BoolVar(&s.verbose, "verbose", s.verbose, "Enable verbose output (same as -log-level debug, unless -log-level is given)")
+	fs.StringVar(&s.logFormat, "log-format", s.logFormat, "Log format: text or json")
+	fs.StringVar(&s.logLevel, "log-level", s.logLevel, "Log level: debug, info, warn or error")
+}
+
+// applyVerbose turns -verbose into -log-level debug, unless a log level was given explicitly
+func applyVerbose(fs *flag.FlagSet, s *cliSettings) {
+	if !s.verbose {
+		return
+	}
+
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "log-level" {
+			explicit = true
+		}
+	})
+	if !explicit {
+		s.logLevel = "debug"
+	}
+}
+
+// newCLISettings returns the settings used when a flag is not given
+func newCLISettings() *cliSettings {
+	return &cliSettings{
+		Options: Options{
+			ConfigFile: DefaultConfigFile,
+			ConsulAddr: DefaultConsulAddr,
+			Datacenter: DefaultDatacenter,
+			BackupDir:  DefaultBackupDir,
+			PullDir:    DefaultPullDir,
+			Output:     OutputText,
+			MultiDoc:   true,
+			MaxSize:    DefaultMaxValueSize,
+		},
+		logFormat: LogFormatText,
+		logLevel:  DefaultLogLevel,
+	}
+}
+
+// environmentArg takes the environment from the only positional argument or from -env
+func environmentArg(s *cliSettings, args []string) error {
+	switch {
+	case len(args) > 1:
+		return fmt.Errorf("expected a single environment, got %s", strings.Join(args, " "))
+	case len(args) == 1 && s.Environment != "" && s.Environment != args[0]:
+		return fmt.Errorf("environment given both as '%s' and as -env %s", args[0], s.Environment)
+	case len(args) == 1:
+		s.Environment = args[0]
+	case s.Environment == "":
+		return fmt.Errorf("an environment is required")
+	}
+	return nil
+}
+
+// singleArg stores the only positional argument in target
+func singleArg(args []string, what string, target *string) error {
+	if len(args) != 1 || args[0] == "" {
+		return fmt.Errorf("expected %s", what)
+	}
+	*target = args[0]
+	return nil
+}
+
+func noArgs(_ *cliSettings, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+	return nil
+}
+
+// runCLI runs the command line and returns the exit status. Arguments that start with a flag
+// are handled by the single flag set of earlier versions.
+func runCLI(args []string) int {
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		return runLegacy(args)
+	}
+
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return ExitError
+	}
+
+	if args[0] == "help" {
+		if len(args) > 1 && findCommand(args[1]) != nil {
+			cmd := findCommand(args[1])
+			cmd.flagSet(newCLISettings(), os.Stdout).Usage()
+			return 0
+		}
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Error: unknown command '%s'\n\n", args[0])
+		printUsage(os.Stderr)
+		return ExitError
+	}
+
+	s, err := cmd.parse(args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return ExitError
+	}
+
+	if cmd.run != nil {
+		if err := cmd.run(s, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitError
+		}
+		return 0
+	}
+	return execute(s)
+}
+
+// findCommand returns the command with the given name or alias
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name || containsString(cmd.aliases, name) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flag set of the command, writing its usage to output
+func (c *command) flagSet(s *cliSettings, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(programName()+" "+c.name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	for _, register := range c.flags {
+		register(fs, s)
+	}
+
+	fs.Usage = func() {
+		synopsis := programName() + " " + c.name
+		if len(c.flags) > 0 {
+			synopsis += " [options]"
+		}
+		if c.args != "" {
+			synopsis += " " + c.args
+		}
+		fmt.Fprintf(output, "Usage: %s\n\n%s\n", synopsis, c.summary)
+		if len(c.aliases) > 0 {
+			fmt.Fprintf(output, "\nAliases: %s\n", strings.Join(c.aliases, ", "))
+		}
+		if len(c.flags) > 0 {
+			fmt.Fprintf(output, "\nOptions:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parse parses the flags and positional arguments of the command. Errors are reported to output
+// together with the usage of the command.
+func (c *command) parse(args []string, output io.Writer) (*cliSettings, error) {
+	s := newCLISettings()
+	fs := c.flagSet(s, output)
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	applyVerbose(fs, s)
+
+	if err := c.prepare(s, positional); err != nil {
+		fmt.Fprintf(output, "Error: %v\n\n", err)
+		fs.Usage()
+		return nil, err
+	}
+	if err := checkOutput(s.Output); err != nil {
+		fmt.Fprintf(output, "Error: %v\n\n", err)
+		fs.Usage()
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseInterspersed parses flags that may appear both before and after positional arguments,
+// e.g. "sync production -dry-run", and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		remaining := fs.Args()
+		if len(remaining) == 0 {
+			return positional, nil
+		}
+
+		// Everything after "--" is positional
+		if len(args) > len(remaining) && args[len(args)-len(remaining)-1] == "--" {
+			return append(positional, remaining...), nil
+		}
+
+		positional = append(positional, remaining[0])
+		args = remaining[1:]
+	}
+}
+
+// checkOutput validates the -output format
+func checkOutput(output string) error {
+	if output != OutputText && output != OutputJSON {
+		return fmt.Errorf("-output must be '%s' or '%s'", OutputText, OutputJSON)
+	}
+	return nil
+}
+
+// printUsage writes the list of commands
+func printUsage(w io.Writer) {
+	name := programName()
+	fmt.Fprintf(w, "Usage: %s <command> [options] [arguments]\n\n", name)
+	fmt.Fprintf(w, "consul-kv-sync synchronizes YAML files to Consul KV store.\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(tw, "  help\tShow the options of a command\n")
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nExamples:\n")
+	fmt.Fprintf(w, "  %s sync production\n", name)
+	fmt.Fprintf(w, "  %s plan staging\n", name)
+	fmt.Fprintf(w, "  %s validate production -report github\n", name)
+	fmt.Fprintf(w, "  %s diff production -extra\n", name)
+	fmt.Fprintf(w, "  %s export production > production-kv.json\n", name)
+	fmt.Fprintf(w, "  consul kv export app/ | %s import - -dry-run\n", name)
+	fmt.Fprintf(w, "\nRun '%s help <command>' for the options of a command. The flags of earlier\n", name)
+	fmt.Fprintf(w, "versions, e.g. '%s -env production -dry-run', still work; see '%s -h'.\n", name, name)
+}
+
+// listEnvironments prints the names of the environments in the configuration file
+func listEnvironments(s *cliSettings, stdout io.Writer) error {
+	config, err := loadEnvironments(s.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	names := make([]string, 0, len(config.Environments))
+	for name := range config.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintln(stdout, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute runs the sync pipeline with the settings, writes the requested reports and returns the exit status
+func execute(s *cliSettings) int {
+	logger, err := newLogger(os.Stderr, s.logFormat, s.logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+
+	ctx, cancel := newRunContext(s.timeout)
+	defer cancel()
+
+	opts := s.Options
+	slog.SetDefault(logger.With(runLogAttrs(opts)...))
+
+	report := &RunReport{}
+	err = run(ctx, opts, report)
+	report.Fail(err)
+
+	if reportErr := writeReports(opts.Reports, report, statusWriter(opts)); reportErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", reportErr)
+		if err == nil {
+			return ExitError
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, ErrDriftDetected) {
+			return ExitDrift
+		}
+		return ExitError
+	}
+
+	return 0
+}
+
+// programName returns the name the program was started with
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// versionString returns the version set at build time, or the module version when installed with go install
+func versionString() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    func(s *cliSettings)
+		wantErr string
+	}{
+		{
+			name: "sync with positional environment",
+			args: []string{"sync", "production"},
+			want: func(s *cliSettings) { s.Environment = "production" },
+		},
+		{
+			name: "sync with flags after the environment",
+			args: []string{"sync", "production", "-backup", "-consul-addr", "http://consul:8500", "-timeout", "5m"},
+			want: func(s *cliSettings) {
+				s.Environment = "production"
+				s.Backup = true
+				s.ConsulAddr = "http://consul:8500"
+				s.timeout = 5 * time.Minute
+			},
+		},
+		{
+			name: "sync with -env",
+			args: []string{"sync", "-env", "staging", "-dry-run"},
+			want: func(s *cliSettings) {
+				s.Environment = "staging"
+				s.DryRun = true
+			},
+		},
+		{
+			name: "plan",
+			args: []string{"plan", "-interpolate", "staging"},
+			want: func(s *cliSettings) {
+				s.Environment = "staging"
+				s.DryRun = true
+				s.Interpolate = true
+			},
+		},
+		{
+			name: "validate",
+			args: []string{"validate", "production", "-report", "github", "-strict"},
+			want: func(s *cliSettings) {
+				s.Environment = "production"
+				s.Validate = true
+				s.Strict = true
+				s.Reports = []ReportSpec{{Format: ReportGitHub}}
+			},
+		},
+		{
+			name: "export",
+			args: []string{"export", "production", "-multi-doc=false"},
+			want: func(s *cliSettings) {
+				s.Environment = "production"
+				s.Export = true
+				s.MultiDoc = false
+			},
+		},
+		{
+			name: "check is an alias of diff",
+			args: []string{"check", "production", "-extra"},
+			want: func(s *cliSettings) {
+				s.Environment = "production"
+				s.Check = true
+				s.CheckExtra = true
+			},
+		},
+		{
+			name: "import from stdin",
+			args: []string{"import", "-", "-dry-run", "-output", "json"},
+			want: func(s *cliSettings) {
+				s.Import = StdinPath
+				s.DryRun = true
+				s.Output = OutputJSON
+			},
+		},
+		{
+			name: "restore",
+			args: []string{"restore", "backups/production.json"},
+			want: func(s *cliSettings) { s.Restore = "backups/production.json" },
+		},
+		{
+			name: "pull",
+			args: []string{"pull", "app", "-split", "-dir", "kv-files/production", "-env", "production"},
+			want: func(s *cliSettings) {
+				s.Pull = "app"
+				s.Split = true
+				s.PullDir = "kv-files/production"
+				s.Environment = "production"
+			},
+		},
+		{
+			name: "verbose",
+			args: []string{"sync", "production", "-verbose"},
+			want: func(s *cliSettings) {
+				s.Environment = "production"
+				s.verbose = true
+				s.logLevel = "debug"
+			},
+		},
+		{
+			name: "explicit log level wins over verbose",
+			args: []string{"sync", "production", "-verbose", "-log-level", "error"},
+			want: func(s *cliSettings) {
+				s.Environment = "production"
+				s.verbose = true
+				s.logLevel = "error"
+			},
+		},
+		{
+			name: "arguments after --",
+			args: []string{"import", "--", "-"},
+			want: func(s *cliSettings) { s.Import = StdinPath },
+		},
+		{name: "missing environment", args: []string{"sync"}, wantErr: "an environment is required"},
+		{name: "two environments", args: []string{"plan", "a", "b"}, wantErr: "expected a single environment, got a b"},
+		{name: "conflicting environments", args: []string{"sync", "a", "-env", "b"}, wantErr: "environment given both as 'a' and as -env b"},
+		{name: "missing import file", args: []string{"import"}, wantErr: "expected an export file"},
+		{name: "invalid output", args: []string{"sync", "production", "-output", "xml"}, wantErr: "-output must be 'text' or 'json'"},
+		{name: "flag of another command", args: []string{"validate", "production", "-dry-run"}, wantErr: "flag provided but not defined: -dry-run"},
+		{name: "unexpected argument", args: []string{"version", "now"}, wantErr: "unexpected arguments: now"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := findCommand(tt.args[0])
+			if cmd == nil {
+				t.Fatalf("findCommand(%q) = nil", tt.args[0])
+			}
+
+			var output bytes.Buffer
+			got, err := cmd.parse(tt.args[1:], &output)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(output.String(), tt.wantErr) {
+					t.Fatalf("parse() error = %v, output:\n%s\nwant %q", err, output.String(), tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse() error = %v\n%s", err, output.String())
+			}
+
+			want := newCLISettings()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parse() = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCommandHelp(t *testing.T) {
+	var output bytes.Buffer
+	_, err := findCommand("diff").parse([]string{"-h"}, &output)
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("parse(-h) error = %v", err)
+	}
+	for _, want := range []string{"diff [options] <environment>", "Aliases: check", "-extra"} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("usage does not contain %q:\n%s", want, output.String())
+		}
+	}
+
+	var usage bytes.Buffer
+	printUsage(&usage)
+	for _, cmd := range commands {
+		if !strings.Contains(usage.String(), "  "+cmd.name+" ") {
+			t.Errorf("usage does not list %s:\n%s", cmd.name, usage.String())
+		}
+	}
+}
+
+func TestListEnvironments(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"environments.yaml": "staging: [a.yaml]\nproduction:\n  files: [a.yaml]\ndevelopment: [a.yaml]\n",
+	})
+
+	s, err := findCommand("envs").parse([]string{"-config", filepath.Join(dir, "environments.yaml")}, io.Discard)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := listEnvironments(s, &stdout); err != nil {
+		t.Fatalf("listEnvironments() error = %v", err)
+	}
+	if got, want := stdout.String(), "development\nproduction\nstaging\n"; got != want {
+		t.Errorf("listEnvironments() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckModeFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(s *cliSettings)
+		wantErr string
+	}{
+		{name: "sync", set: func(s *cliSettings) {}},
+		{name: "single mode", set: func(s *cliSettings) { s.Check = true; s.CheckExtra = true }},
+		{name: "check and export", set: func(s *cliSettings) { s.Check = true; s.Export = true }, wantErr: "-check and -export cannot be used together"},
+		{name: "validate and dry run", set: func(s *cliSettings) { s.Validate = true; s.DryRun = true }, wantErr: "-validate and -dry-run cannot be used together"},
+		{name: "three modes", set: func(s *cliSettings) { s.Check = true; s.Export = true; s.DryRun = true }, wantErr: "-check, -export and -dry-run cannot be used together"},
+		{name: "import dry run", set: func(s *cliSettings) { s.Import = "exp.json"; s.DryRun = true }},
+		{name: "restore dry run", set: func(s *cliSettings) { s.Restore = "backup.json"; s.DryRun = true }},
+		{name: "pull", set: func(s *cliSettings) { s.Pull = "app"; s.Split = true }},
+		{name: "import check", set: func(s *cliSettings) { s.Import = "exp.json"; s.Check = true }, wantErr: "-check cannot be used with -import"},
+		{name: "import export", set: func(s *cliSettings) { s.Import = "exp.json"; s.Export = true }, wantErr: "-export cannot be used with -import"},
+		{name: "import validate", set: func(s *cliSettings) { s.Import = "exp.json"; s.Validate = true }, wantErr: "-validate cannot be used with -import"},
+		{name: "restore check", set: func(s *cliSettings) { s.Restore = "backup.json"; s.Check = true }, wantErr: "-check cannot be used with -restore"},
+		{name: "restore export", set: func(s *cliSettings) { s.Restore = "backup.json"; s.Export = true }, wantErr: "-export cannot be used with -restore"},
+		{name: "restore validate", set: func(s *cliSettings) { s.Restore = "backup.json"; s.Validate = true }, wantErr: "-validate cannot be used with -restore"},
+		{name: "pull check", set: func(s *cliSettings) { s.Pull = "app"; s.Check = true }, wantErr: "-check cannot be used with -pull"},
+		{name: "pull export", set: func(s *cliSettings) { s.Pull = "app"; s.Export = true }, wantErr: "-export cannot be used with -pull"},
+		{name: "pull validate", set: func(s *cliSettings) { s.Pull = "app"; s.Validate = true }, wantErr: "-validate cannot be used with -pull"},
+		{name: "pull dry run", set: func(s *cliSettings) { s.Pull = "app"; s.DryRun = true }, wantErr: "-dry-run cannot be used with -pull"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCLISettings()
+			tt.set(s)
+
+			err := checkModeFlags(s)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkModeFlags() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkModeFlags() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
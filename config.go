@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -27,18 +31,159 @@ func loadEnvironments(configPath string) (*Config, error) {
 	return &config, nil
 }
 
-// getEnvironmentFiles returns the list of files for the specified environment
-func getEnvironmentFiles(config *Config, environment string) ([]string, error) {
-	files, exists := config.Environments[environment]
+// UnmarshalYAML accepts either a plain list of files or a mapping with files and settings
+func (e *Environment) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode(&e.Files)
+	}
+
+	if err := checkKnownFields(node, reflect.TypeOf(*e)); err != nil {
+		return err
+	}
+
+	type plain Environment
+	return node.Decode((*plain)(e))
+}
+
+// UnmarshalYAML accepts either a plain path or a mapping with a path and a format
+func (f *FileEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&f.Path)
+	}
+
+	if err := checkKnownFields(node, reflect.TypeOf(*f)); err != nil {
+		return err
+	}
+
+	type plain FileEntry
+	if err := node.Decode((*plain)(f)); err != nil {
+		return err
+	}
+
+	if f.Path == "" {
+		return fmt.Errorf("line %d: file entry has no path", node.Line)
+	}
+	if _, ok := formatLoaders[f.Format]; f.Format != "" && !ok {
+		return fmt.Errorf("line %d: unknown format '%s' (supported: %s)", node.Line, f.Format, strings.Join(supportedFormats(), ", "))
+	}
+
+	return nil
+}
+
+// UnmarshalYAML reads a mapping of key to file path, keeping the line of every key
+func (f *FileValues) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: file_values must be a mapping of key to file path", node.Line)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.Value == "" {
+			return fmt.Errorf("line %d: file_values entry '%s' expects a file path", key.Line, key.Value)
+		}
+		*f = append(*f, FileValue{Key: strings.Trim(key.Value, "/"), Path: value.Value, Line: key.Line})
+	}
+
+	return nil
+}
+
+// UnmarshalYAML reads a mapping of key pattern to flags, keeping the order of the patterns
+func (f *FlagRules) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: flags must be a mapping of key pattern to flags", node.Line)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		flags, err := strconv.ParseUint(value.Value, 0, 64)
+		if value.Kind != yaml.ScalarNode || err != nil {
+			return fmt.Errorf("line %d: flags of '%s' must be an unsigned 64-bit integer", value.Line, key.Value)
+		}
+		*f = append(*f, FlagRule{Pattern: key.Value, Flags: flags})
+	}
+
+	return nil
+}
+
+// UnmarshalYAML accepts either the path of a schema for all keys or a mapping of prefix to schema path
+func (s *SchemaRefs) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.Value != "" {
+		*s = SchemaRefs{{Path: node.Value, Line: node.Line}}
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: schema must be a file path or a mapping of prefix to file path", node.Line)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.Value == "" {
+			return fmt.Errorf("line %d: schema of '%s' expects a file path", key.Line, key.Value)
+		}
+		*s = append(*s, SchemaRef{Prefix: strings.Trim(key.Value, "/"), Path: value.Value, Line: key.Line})
+	}
+
+	return nil
+}
+
+// UnmarshalYAML decodes the key rules and checks that the charset is a valid character class
+func (r *KeyRules) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkKnownFields(node, reflect.TypeOf(*r)); err != nil {
+		return err
+	}
+
+	type plain KeyRules
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+
+	if r.MaxDepth < 0 || r.MaxLength < 0 {
+		return fmt.Errorf("line %d: max_depth and max_length must not be negative", node.Line)
+	}
+	if err := r.compile(); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+
+	return nil
+}
+
+// checkKnownFields rejects mapping keys that do not correspond to a yaml tag of t,
+// so that a typo in a setting is not silently ignored
+func checkKnownFields(node *yaml.Node, t reflect.Type) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		known[name] = true
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i]; !known[key.Value] {
+			return fmt.Errorf("line %d: unknown setting '%s'", key.Line, key.Value)
+		}
+	}
+
+	return nil
+}
+
+// getEnvironment returns the settings of the specified environment
+func getEnvironment(config *Config, environment string) (*Environment, error) {
+	env, exists := config.Environments[environment]
 	if !exists {
 		return nil, buildEnvironmentNotFoundError(config, environment)
 	}
 
-	if len(files) == 0 {
+	if env == nil || len(env.Files) == 0 {
 		return nil, fmt.Errorf("no files defined for environment '%s'", environment)
 	}
 
-	return files, nil
+	return env, nil
 }
 
 // buildEnvironmentNotFoundError creates a helpful error message with available environments
@@ -47,6 +192,7 @@ func buildEnvironmentNotFoundError(config *Config, environment string) error {
 	for env := range config.Environments {
 		availableEnvs = append(availableEnvs, env)
 	}
+	sort.Strings(availableEnvs)
 	return fmt.Errorf("environment '%s' not found. Available environments: %v", environment, availableEnvs)
 }
 
@@ -65,3 +211,17 @@ func resolveFilePaths(configPath string, files []string) []string {
 
 	return resolvedPaths
 }
+
+// resolveFileEntries resolves the paths of file entries like resolveFilePaths
+func resolveFileEntries(configPath string, entries []FileEntry) []FileEntry {
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = entry.Path
+	}
+
+	resolved := make([]FileEntry, len(entries))
+	for i, path := range resolveFilePaths(configPath, paths) {
+		resolved[i] = FileEntry{Path: path, Format: entries[i].Format}
+	}
+	return resolved
+}
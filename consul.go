@@ -2,10 +2,13 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -33,7 +36,7 @@ func NewConsulClient(addr, datacenter string) *ConsulClient {
 }
 
 // executeTransaction executes a transaction with the given operations
-func (c *ConsulClient) executeTransaction(ops []TxnOp) (*TxnResponse, error) {
+func (c *ConsulClient) executeTransaction(ctx context.Context, ops []TxnOp) (*TxnResponse, error) {
 	url := fmt.Sprintf("%s/v1/txn?dc=%s", c.addr, c.datacenter)
 
 	jsonData, err := json.Marshal(ops)
@@ -41,7 +44,7 @@ func (c *ConsulClient) executeTransaction(ops []TxnOp) (*TxnResponse, error) {
 		return nil, fmt.Errorf("failed to marshal operations: %w", err)
 	}
 
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -75,8 +78,56 @@ func (c *ConsulClient) executeTransaction(ops []TxnOp) (*TxnResponse, error) {
 	}
 }
 
-// syncKVPairs synchronizes all KV pairs to Consul
-func (c *ConsulClient) syncKVPairs(pairs []KVPair, verbose bool) (*ExecutionSummary, error) {
+// listKeys returns all KV entries stored under the given prefix
+func (c *ConsulClient) listKeys(ctx context.Context, prefix string) ([]KVData, error) {
+	reqURL := fmt.Sprintf("%s/v1/kv/%s?recurse=true&dc=%s", c.addr, escapeKeyPath(prefix), url.QueryEscape(c.datacenter))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// Consul answers 404 when no key matches the prefix
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var entries []KVData
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return entries, nil
+}
+
+// escapeKeyPath escapes each segment of a key so it can be used in a URL path
+func escapeKeyPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// syncKVPairs synchronizes all KV pairs to Consul.
+// When ctx is cancelled the in-flight batch is aborted, remaining batches are
+// skipped and the partial summary is returned.
+func (c *ConsulClient) syncKVPairs(ctx context.Context, pairs []KVPair) (*ExecutionSummary, error) {
 	ops := createTransactionOps(pairs)
 	chunks := chunkOps(ops, MaxOpsPerTransaction)
 
@@ -86,28 +137,41 @@ func (c *ConsulClient) syncKVPairs(pairs []KVPair, verbose bool) (*ExecutionSumm
 		Results:      make([]BatchResult, 0, len(chunks)),
 	}
 
-	if verbose {
-		fmt.Printf("Syncing %d key-value pairs in %d batches...\n", len(pairs), len(chunks))
-	}
+	slog.Debug("syncing key-value pairs in batches", "count", len(pairs), "batches", len(chunks))
 
 	for i, chunk := range chunks {
-		if verbose {
-			fmt.Printf("\nProcessing batch %d/%d (%d operations)...\n", i+1, len(chunks), len(chunk))
-			printBatchKeys(chunk)
+		start := i * MaxOpsPerTransaction
+
+		if ctx.Err() != nil {
+			abortSummary(summary, ctx.Err())
+			break
 		}
 
+		batchLog := slog.With("batch", i+1)
+		batchLog.Debug("processing batch", "batches", len(chunks), "operations", len(chunk))
+		logBatchKeys(batchLog, chunk)
+
 		result := BatchResult{
 			BatchIndex:   i,
 			ProcessedOps: len(chunk),
+			Pairs:        pairs[start : start+len(chunk)],
 		}
 
-		txnResp, err := c.executeTransaction(chunk)
+		batchStart := time.Now()
+		txnResp, err := c.executeTransaction(ctx, chunk)
+		result.Duration = time.Since(batchStart)
 		if err != nil {
 			result.Success = false
 			result.Error = err
 			if txnResp != nil {
 				result.OpErrors = txnResp.Errors
 			}
+			if ctx.Err() != nil {
+				// The request was cancelled in flight. Transactions are atomic,
+				// but whether Consul applied this one before the cancellation is unknown.
+				result.Interrupted = true
+				result.Error = fmt.Errorf("batch interrupted, outcome unknown: %w", ctx.Err())
+			}
 			summary.FailedBatches++
 		} else {
 			result.Success = true
@@ -116,25 +180,52 @@ func (c *ConsulClient) syncKVPairs(pairs []KVPair, verbose bool) (*ExecutionSumm
 
 		summary.Results = append(summary.Results, result)
 
-		if verbose && result.Success {
-			fmt.Printf("Batch %d/%d completed successfully\n", i+1, len(chunks))
+		if result.Success {
+			batchLog.Debug("batch completed successfully", "duration", result.Duration)
+		} else {
+			batchLog.Warn("batch failed", "error", result.Error)
 		}
 
 		// Add a small delay between batches to avoid overwhelming the server
 		if i < len(chunks)-1 {
-			time.Sleep(100 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
 		}
 	}
 
+	if ctx.Err() != nil && !summary.Aborted {
+		abortSummary(summary, ctx.Err())
+	}
+
 	return summary, nil
 }
 
-// printBatchKeys prints all keys in a batch
-func printBatchKeys(ops []TxnOp) {
-	fmt.Println("Keys to be registered:")
+// abortSummary marks the summary as aborted and counts the batches that were never attempted
+func abortSummary(summary *ExecutionSummary, cause error) {
+	summary.Aborted = true
+	summary.AbortReason = describeContextError(cause)
+	summary.SkippedBatches = summary.TotalBatches - len(summary.Results)
+}
+
+// describeContextError returns a human readable reason for a context error
+func describeContextError(err error) string {
+	switch err {
+	case context.DeadlineExceeded:
+		return "timeout exceeded"
+	case context.Canceled:
+		return "interrupted"
+	default:
+		return err.Error()
+	}
+}
+
+// logBatchKeys logs every key in a batch at debug level
+func logBatchKeys(logger *slog.Logger, ops []TxnOp) {
 	for _, op := range ops {
 		if op.KV != nil {
-			fmt.Printf("  - %s\n", op.KV.Key)
+			logger.Debug("key to be registered", "key", op.KV.Key)
 		}
 	}
 }
@@ -146,6 +237,10 @@ func formatExecutionSummary(summary *ExecutionSummary) string {
 	writeHeader(&sb)
 	writeSummaryStats(&sb, summary)
 
+	if summary.Aborted {
+		writeCompletedBatches(&sb, summary)
+	}
+
 	if summary.FailedBatches > 0 {
 		writeFailedBatches(&sb, summary)
 	}
@@ -163,9 +258,37 @@ func writeHeader(sb *strings.Builder) {
 
 func writeSummaryStats(sb *strings.Builder, summary *ExecutionSummary) {
 	sb.WriteString(fmt.Sprintf("Total key-value pairs: %d\n", summary.TotalKeys))
+	if summary.CountsUnknown {
+		sb.WriteString("Added, changed and unchanged keys: unknown, current values could not be read so no key was skipped\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("Added keys: %d\n", summary.AddedKeys))
+		sb.WriteString(fmt.Sprintf("Changed keys: %d\n", summary.ChangedKeys))
+		sb.WriteString(fmt.Sprintf("Unchanged keys (skipped): %d\n", summary.SkippedKeys))
+	}
 	sb.WriteString(fmt.Sprintf("Total batches: %d\n", summary.TotalBatches))
 	sb.WriteString(fmt.Sprintf("Successful batches: %d\n", summary.SuccessBatches))
 	sb.WriteString(fmt.Sprintf("Failed batches: %d\n", summary.FailedBatches))
+	if summary.Aborted {
+		sb.WriteString(fmt.Sprintf("Skipped batches: %d\n", summary.SkippedBatches))
+	}
+	if summary.Duration > 0 {
+		sb.WriteString(fmt.Sprintf("Duration: %s\n", summary.Duration.Round(time.Millisecond)))
+	}
+}
+
+func writeCompletedBatches(sb *strings.Builder, summary *ExecutionSummary) {
+	completed := make([]string, 0, len(summary.Results))
+	for _, result := range summary.Results {
+		if result.Success {
+			completed = append(completed, fmt.Sprintf("%d", result.BatchIndex+1))
+		}
+	}
+
+	if len(completed) == 0 {
+		sb.WriteString("\nCompleted batches: none\n")
+		return
+	}
+	sb.WriteString(fmt.Sprintf("\nCompleted batches: %s\n", strings.Join(completed, ", ")))
 }
 
 func writeFailedBatches(sb *strings.Builder, summary *ExecutionSummary) {
@@ -175,19 +298,40 @@ func writeFailedBatches(sb *strings.Builder, summary *ExecutionSummary) {
 	for _, result := range summary.Results {
 		if !result.Success {
 			sb.WriteString(fmt.Sprintf("Batch %d (failed with %d operations): %v\n", result.BatchIndex+1, result.ProcessedOps, result.Error))
-			writeOperationErrors(sb, result.OpErrors)
+			writeOperationErrors(sb, result)
+		}
+	}
+}
+
+func writeOperationErrors(sb *strings.Builder, result BatchResult) {
+	for _, opErr := range result.OpErrors {
+		pair, ok := opErrorPair(result, opErr)
+		if !ok {
+			sb.WriteString(fmt.Sprintf("  - Operation %d: %s\n", opErr.OpIndex, opErr.What))
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("  - Key: %s\n", pair.Key))
+		if pair.File != "" {
+			sb.WriteString(fmt.Sprintf("    Source: %s\n", formatLocation(pair.File, pair.Line)))
 		}
+		sb.WriteString(fmt.Sprintf("    Value: %q\n", displayValue(pair.Value, pair.Sensitive)))
+		sb.WriteString(fmt.Sprintf("    Error: %s\n", opErr.What))
 	}
 }
 
-func writeOperationErrors(sb *strings.Builder, errors []TxnError) {
-	for _, opErr := range errors {
-		sb.WriteString(fmt.Sprintf("  - Operation %d: %s\n", opErr.OpIndex, opErr.What))
+// opErrorPair resolves the OpIndex of a transaction error to the KV pair the operation was writing
+func opErrorPair(result BatchResult, opErr TxnError) (KVPair, bool) {
+	if opErr.OpIndex < 0 || opErr.OpIndex >= len(result.Pairs) {
+		return KVPair{}, false
 	}
+	return result.Pairs[opErr.OpIndex], true
 }
 
 func writeStatusMessage(sb *strings.Builder, summary *ExecutionSummary) {
 	switch {
+	case summary.Aborted:
+		sb.WriteString(fmt.Sprintf("\n[ABORTED] Sync aborted (%s): %d of %d batches completed.\n", summary.AbortReason, summary.SuccessBatches, summary.TotalBatches))
 	case summary.SuccessBatches == summary.TotalBatches:
 		sb.WriteString("\n[SUCCESS] All operations completed successfully!\n")
 	case summary.SuccessBatches > 0:
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSyncKVPairsCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests := 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 {
+			// Simulate Ctrl-C while the second batch is in flight
+			cancel()
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		fmt.Fprint(w, `{"Results":[],"Errors":null}`)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	pairs := make([]KVPair, MaxOpsPerTransaction*3)
+	for i := range pairs {
+		pairs[i] = KVPair{Key: fmt.Sprintf("key%d", i), Value: "value"}
+	}
+
+	client := NewConsulClient(server.URL, DefaultDatacenter)
+	summary, err := client.syncKVPairs(ctx, pairs)
+	if err != nil {
+		t.Fatalf("syncKVPairs() error = %v", err)
+	}
+
+	if !summary.Aborted {
+		t.Fatal("expected summary to be aborted")
+	}
+	if summary.SuccessBatches != 1 || summary.FailedBatches != 1 || summary.SkippedBatches != 1 {
+		t.Errorf("got success=%d failed=%d skipped=%d, want 1/1/1",
+			summary.SuccessBatches, summary.FailedBatches, summary.SkippedBatches)
+	}
+	if !summary.Results[1].Interrupted {
+		t.Error("expected second batch to be marked as interrupted")
+	}
+
+	output := formatExecutionSummary(summary)
+	for _, want := range []string{"Skipped batches: 1", "Completed batches: 1\n", "[ABORTED] Sync aborted (interrupted)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("summary output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+// fakeConsul is an in-memory stand-in for the Consul KV and transaction endpoints
+type fakeConsul struct {
+	mu        sync.Mutex
+	data      map[string]string
+	denyReads bool // answer reads with 403, like a token with a write-only ACL
+}
+
+func newFakeConsul(t *testing.T, initial map[string]string) (*fakeConsul, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeConsul{data: make(map[string]string)}
+	for k, v := range initial {
+		fake.data[k] = v
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeConsul) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/kv/") && f.denyReads:
+		w.WriteHeader(http.StatusForbidden)
+
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		keys := make([]string, 0)
+		for key := range f.data {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Strings(keys)
+
+		entries := make([]KVData, len(keys))
+		for i, key := range keys {
+			entries[i] = KVData{Key: key, Value: encodeValue(f.data[key])}
+		}
+		json.NewEncoder(w).Encode(entries)
+
+	case r.Method == "PUT" && r.URL.Path == "/v1/txn":
+		var ops []TxnOp
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, op := range ops {
+			value, _ := base64.StdEncoding.DecodeString(op.KV.Value)
+			f.data[op.KV.Key] = string(value)
+		}
+		fmt.Fprint(w, `{"Results":[],"Errors":null}`)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestFormatExecutionSummaryResolvesOpErrors(t *testing.T) {
+	summary := &ExecutionSummary{
+		TotalBatches:  1,
+		FailedBatches: 1,
+		Results: []BatchResult{
+			{
+				BatchIndex:   0,
+				ProcessedOps: 2,
+				Error:        fmt.Errorf("transaction rolled back with 1 errors"),
+				Pairs: []KVPair{
+					{Key: "app/name", Value: "myapp", File: "kv-files/app.yaml", Line: 3},
+					{Key: "app/server/port", Value: "eighty", File: "kv-files/app.yaml", Line: 7},
+				},
+				OpErrors: []TxnError{{OpIndex: 1, What: "invalid value"}},
+			},
+		},
+	}
+
+	output := formatExecutionSummary(summary)
+	for _, want := range []string{
+		"  - Key: app/server/port\n",
+		"    Source: kv-files/app.yaml:7\n",
+		"    Value: \"eighty\"\n",
+		"    Error: invalid value\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("summary output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestApplyKVPairsWithoutReadAccess(t *testing.T) {
+	fake, server := newFakeConsul(t, map[string]string{"app/name": "myapp"})
+	fake.denyReads = true
+
+	pairs := []KVPair{
+		{Key: "app/name", Value: "myapp"},
+		{Key: "app/port", Value: "8080"},
+	}
+	opts := Options{ConsulAddr: server.URL, Datacenter: DefaultDatacenter, Output: OutputJSON}
+
+	report := &RunReport{}
+	if err := applyKVPairs(context.Background(), opts, pairs, report); err != nil {
+		t.Fatalf("applyKVPairs() error = %v", err)
+	}
+	if fake.data["app/port"] != "8080" {
+		t.Errorf("app/port = %q, want every key written", fake.data["app/port"])
+	}
+	if report.Summary == nil || !report.Summary.CountsUnknown || report.Summary.SuccessBatches != 1 {
+		t.Errorf("summary = %+v, want unknown counts and one successful batch", report.Summary)
+	}
+
+	// A backup needs the current values, so the sync must not go ahead without them
+	opts.Backup = true
+	opts.BackupDir = t.TempDir()
+	err := applyKVPairs(context.Background(), opts, pairs, &RunReport{})
+	if err == nil || !strings.Contains(err.Error(), "nothing was synced") {
+		t.Errorf("applyKVPairs(backup) error = %v, want nothing synced", err)
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EncryptedTag marks a value holding an ASCII-armored age ciphertext
+	EncryptedTag = "!encrypted"
+
+	// SOPSMetadataKey is the top-level key under which SOPS stores its metadata
+	SOPSMetadataKey = "sops"
+)
+
+// Environment variables and paths read when looking for keys, the same ones sops uses
+const (
+	SOPSAgeKeyEnv        = "SOPS_AGE_KEY"
+	SOPSAgeKeyFileEnv    = "SOPS_AGE_KEY_FILE"
+	SOPSAgeKeyUserPath   = "sops/age/keys.txt"
+	SOPSGPGExecEnv       = "SOPS_GPG_EXEC"
+	DefaultGPGExecutable = "gpg"
+	sopsDataKeySize      = 32
+)
+
+// sopsValuePattern matches a value encrypted by sops
+var sopsValuePattern = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.+),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// sopsMACOnlyEncryptedInitialization is written to the MAC first when mac_only_encrypted is set
+var sopsMACOnlyEncryptedInitialization = []byte{
+	0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66, 0x52, 0x7b, 0x10, 0x34, 0xf3, 0xd1, 0x47, 0xbe, 0x0b,
+	0x0b, 0x97, 0x5b, 0x3b, 0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69,
+}
+
+// decryptDocuments replaces SOPS-encrypted values and !encrypted values in the documents of a file
+// with their plaintext. Decrypted values are tagged !secret so they are redacted in every report.
+func decryptDocuments(roots []*yaml.Node) error {
+	keys := &keyring{}
+
+	// Like sops, use the metadata of the first document and drop it from every document
+	var metadata *SOPSMetadata
+	for _, root := range roots {
+		found, err := removeSOPSMetadata(root)
+		if err != nil {
+			return err
+		}
+		if metadata == nil {
+			metadata = found
+		}
+	}
+
+	if metadata != nil {
+		if err := decryptSOPS(roots, metadata, keys); err != nil {
+			return err
+		}
+	}
+
+	for _, root := range roots {
+		if err := decryptTaggedValues(root, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyring loads the local age identities once, on first use
+type keyring struct {
+	identities []age.Identity
+	err        error
+	loaded     bool
+}
+
+func (k *keyring) ageIdentities() ([]age.Identity, error) {
+	if !k.loaded {
+		k.identities, k.err = loadAgeIdentities()
+		k.loaded = true
+	}
+	return k.identities, k.err
+}
+
+// loadAgeIdentities reads age identities from SOPS_AGE_KEY, SOPS_AGE_KEY_FILE and the
+// sops keys file in the user config directory
+func loadAgeIdentities() ([]age.Identity, error) {
+	var identities []age.Identity
+
+	if key, ok := os.LookupEnv(SOPSAgeKeyEnv); ok {
+		parsed, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", SOPSAgeKeyEnv, err)
+		}
+		identities = append(identities, parsed...)
+	}
+
+	if path, ok := os.LookupEnv(SOPSAgeKeyFileEnv); ok {
+		parsed, err := parseAgeIdentityFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", SOPSAgeKeyFileEnv, err)
+		}
+		identities = append(identities, parsed...)
+	}
+
+	if path, err := userAgeKeyFile(); err == nil {
+		parsed, err := parseAgeIdentityFile(path)
+		switch {
+		case err == nil:
+			identities = append(identities, parsed...)
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no age identities found (set %s or %s, or create %s in the user config directory)",
+			SOPSAgeKeyFileEnv, SOPSAgeKeyEnv, SOPSAgeKeyUserPath)
+	}
+
+	return identities, nil
+}
+
+// userAgeKeyFile returns the default sops age keys file, honouring XDG_CONFIG_HOME on every platform
+func userAgeKeyFile() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(SOPSAgeKeyUserPath)), nil
+}
+
+func parseAgeIdentityFile(path string) ([]age.Identity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return age.ParseIdentities(file)
+}
+
+// decryptAgeArmored decrypts an ASCII-armored age ciphertext
+func decryptAgeArmored(ciphertext string, identities []age.Identity) ([]byte, error) {
+	reader, err := age.Decrypt(armor.NewReader(strings.NewReader(strings.TrimSpace(ciphertext)+"\n")), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// decryptPGP decrypts an ASCII-armored PGP message with the local gpg keyring
+func decryptPGP(ciphertext string) ([]byte, error) {
+	executable := os.Getenv(SOPSGPGExecEnv)
+	if executable == "" {
+		executable = DefaultGPGExecutable
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(executable, "--batch", "--no-tty", "--quiet", "--decrypt")
+	cmd.Stdin = strings.NewReader(ciphertext)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// decryptTaggedValues decrypts every scalar tagged !encrypted below node
+func decryptTaggedValues(node *yaml.Node, keys *keyring) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == EncryptedTag {
+		identities, err := keys.ageIdentities()
+		if err != nil {
+			return fmt.Errorf("line %d: cannot decrypt %s value: %w", node.Line, EncryptedTag, err)
+		}
+
+		plaintext, err := decryptAgeArmored(node.Value, identities)
+		if err != nil {
+			return fmt.Errorf("line %d: cannot decrypt %s value: %w", node.Line, EncryptedTag, err)
+		}
+
+		setDecryptedValue(node, string(plaintext))
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := decryptTaggedValues(child, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDecryptedValue replaces a scalar with its plaintext and marks it sensitive
+func setDecryptedValue(node *yaml.Node, value string) {
+	node.Value = value
+	node.Tag = SecretTag
+	node.Style = 0
+}
+
+// removeSOPSMetadata removes the sops section from a document and returns it, or nil if there is none.
+// A sops key without the fields sops always writes is ordinary configuration and is left alone.
+func removeSOPSMetadata(root *yaml.Node) (*SOPSMetadata, error) {
+	if root.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != SOPSMetadataKey || !isSOPSMetadata(root.Content[i+1]) {
+			continue
+		}
+
+		var metadata SOPSMetadata
+		if err := root.Content[i+1].Decode(&metadata); err != nil {
+			return nil, fmt.Errorf("invalid sops metadata: %w", err)
+		}
+
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		return &metadata, nil
+	}
+
+	return nil, nil
+}
+
+// isSOPSMetadata reports whether node is a mapping with the mac, lastmodified and version fields
+// that sops writes into every file it encrypts
+func isSOPSMetadata(node *yaml.Node) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+
+	missing := map[string]bool{"mac": true, "lastmodified": true, "version": true}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		delete(missing, node.Content[i].Value)
+	}
+	return len(missing) == 0
+}
+
+// decryptSOPS decrypts the documents of a file encrypted by sops and verifies its MAC
+func decryptSOPS(roots []*yaml.Node, metadata *SOPSMetadata, keys *keyring) error {
+	if len(metadata.KeyGroups) > 0 {
+		return fmt.Errorf("sops key groups are not supported, encrypt the file with plain age or PGP keys")
+	}
+
+	dataKey, err := sopsDataKey(metadata, keys)
+	if err != nil {
+		return err
+	}
+
+	walker := &sopsWalker{key: dataKey, hash: sha512.New(), macOnlyEncrypted: metadata.MACOnlyEncrypted}
+	if metadata.MACOnlyEncrypted {
+		walker.hash.Write(sopsMACOnlyEncryptedInitialization)
+	}
+	for _, root := range roots {
+		if err := walker.walk(root, nil); err != nil {
+			return err
+		}
+	}
+
+	return verifySOPSMAC(metadata, dataKey, fmt.Sprintf("%X", walker.hash.Sum(nil)))
+}
+
+// sopsDataKey decrypts the data key with the first age identity or PGP key that can
+func sopsDataKey(metadata *SOPSMetadata, keys *keyring) ([]byte, error) {
+	var failures []string
+
+	if len(metadata.Age) > 0 {
+		identities, err := keys.ageIdentities()
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+		for _, entry := range metadata.Age {
+			if err != nil {
+				break
+			}
+			dataKey, decryptErr := decryptAgeArmored(entry.Enc, identities)
+			if decryptErr == nil {
+				return checkDataKey(dataKey)
+			}
+			failures = append(failures, fmt.Sprintf("age recipient %s: %v", entry.Recipient, decryptErr))
+		}
+	}
+
+	for _, entry := range metadata.PGP {
+		dataKey, err := decryptPGP(entry.Enc)
+		if err == nil {
+			return checkDataKey(dataKey)
+		}
+		failures = append(failures, fmt.Sprintf("PGP key %s: %v", entry.Fingerprint, err))
+	}
+
+	if len(failures) == 0 {
+		return nil, fmt.Errorf("file has no age or PGP keys, other sops key types are not supported")
+	}
+
+	return nil, fmt.Errorf("failed to decrypt sops data key:\n  %s", strings.Join(failures, "\n  "))
+}
+
+func checkDataKey(dataKey []byte) ([]byte, error) {
+	if len(dataKey) != sopsDataKeySize {
+		return nil, fmt.Errorf("sops data key has %d bytes, expected %d", len(dataKey), sopsDataKeySize)
+	}
+	return dataKey, nil
+}
+
+// verifySOPSMAC compares the MAC stored in the metadata with the one computed over the values
+func verifySOPSMAC(metadata *SOPSMetadata, dataKey []byte, computed string) error {
+	if metadata.MAC == "" {
+		return fmt.Errorf("sops metadata has no MAC")
+	}
+
+	stored, _, err := decryptSOPSValue(metadata.MAC, dataKey, metadata.LastModified)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt sops MAC: %w", err)
+	}
+
+	if !strings.EqualFold(string(stored), computed) {
+		return fmt.Errorf("sops MAC mismatch, the file was modified after encryption")
+	}
+
+	return nil
+}
+
+// sopsWalker decrypts values in document order and hashes them the way sops does
+type sopsWalker struct {
+	key              []byte
+	hash             hash.Hash
+	macOnlyEncrypted bool
+}
+
+func (w *sopsWalker) walk(node *yaml.Node, path []string) error {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return w.walk(node.Alias, path)
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := w.walk(node.Content[i+1], append(path, node.Content[i].Value)); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		// List items are encrypted with the path of the list itself
+		for _, item := range node.Content {
+			if err := w.walk(item, path); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		return w.scalar(node, path)
+	}
+	return nil
+}
+
+func (w *sopsWalker) scalar(node *yaml.Node, path []string) error {
+	if !sopsValuePattern.MatchString(node.Value) {
+		if !w.macOnlyEncrypted {
+			w.hash.Write(sopsMACBytes(node))
+		}
+		return nil
+	}
+
+	plaintext, valueType, err := decryptSOPSValue(node.Value, w.key, strings.Join(path, ":")+":")
+	if err != nil {
+		return fmt.Errorf("line %d: failed to decrypt %s: %w", node.Line, strings.Join(path, "/"), err)
+	}
+	w.hash.Write(plaintext)
+
+	value := string(plaintext)
+	if valueType == "bool" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid bool value for %s", node.Line, strings.Join(path, "/"))
+		}
+		value = strconv.FormatBool(parsed)
+	}
+
+	setDecryptedValue(node, value)
+	if valueType == "str" {
+		// Keep strings that look like numbers strings when the value's YAML type is resolved again
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	return nil
+}
+
+// sopsMACBytes returns the bytes sops feeds into the MAC for an unencrypted scalar
+func sopsMACBytes(node *yaml.Node) []byte {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return []byte(node.Value)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		if v {
+			return []byte("True")
+		}
+		return []byte("False")
+	case int:
+		return []byte(strconv.Itoa(v))
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return []byte(fmt.Sprintf("%v", v))
+	}
+}
+
+// decryptSOPSValue decrypts a single ENC[AES256_GCM,...] value and returns its plaintext and type
+func decryptSOPSValue(value string, key []byte, additionalData string) ([]byte, string, error) {
+	match := sopsValuePattern.FindStringSubmatch(value)
+	if match == nil {
+		return nil, "", fmt.Errorf("value is not in sops format")
+	}
+
+	var parts [3][]byte
+	for i, name := range []string{"data", "iv", "tag"} {
+		decoded, err := base64.StdEncoding.DecodeString(match[i+1])
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid %s: %w", name, err)
+		}
+		parts[i] = decoded
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, "", err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, "", err
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return nil, "", fmt.Errorf("authentication failed, wrong key or modified value")
+	}
+
+	return plaintext, match[4], nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// testAgeIdentity is a throwaway key; sopsTestDocument was encrypted to it with sops 3.9.0
+const testAgeIdentity = "AGE-SECRET-KEY-17UMJTFYL039SSYX368L8HS72UW3G2QS8WVQ0QPCN8H3ML83ZJQ2SXQNK30"
+
+const sopsTestDocument = `app:
+    name: ENC[AES256_GCM,data:2v2VrMM=,iv:RaFHeiFSKCGRzN8gysTDuRnZ+cWRV0EKQvOthPpDoIA=,tag:gEnJR7KoP+xfC2WYac6nGw==,type:str]
+    db:
+        password: ENC[AES256_GCM,data:lDpdKxSLBQ==,iv:vguUaAPrLf1tq8iAAGytaYjgzKPRGXhoUsiVv7UUBW4=,tag:eA9mcv80sX8ufddQLG2T4w==,type:str]
+        port: ENC[AES256_GCM,data:A5pvKA==,iv:3b/FShewy/AteRrHZXaxoMFz0jpj4xeKV9R39WHeCZg=,tag:29qPSIl5VzgKt79ggVA/9w==,type:int]
+    hosts:
+        - ENC[AES256_GCM,data:KA==,iv:VBTylCRdhzPm2/nupsatzN7K/2m2bCKI1/ezgOjvmYk=,tag:McQGgd6p2Gi/HTkmXiTHKg==,type:str]
+        - ENC[AES256_GCM,data:Xw==,iv:BoJOIvGkn79rs4Ty/K9JTPkjN2uX/1JLrkRbhQve9jo=,tag:IL8Llgafw4LF/9XBFXc5vQ==,type:str]
+sops:
+    kms: []
+    gcp_kms: []
+    azure_kv: []
+    hc_vault: []
+    age:
+        - recipient: age1rtv4ku0rp65842hdfcfapr40h2uu8y0xc2wjs64t4jkx58z64phshymfxw
+          enc: |
+            -----BEGIN AGE ENCRYPTED FILE-----
+            YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSB2eXFTZUh4UlRic2xUeEVs
+            VkZlN3NDWDVnTDFoaFpMeXNlN1pUNnNOZmxFCjFYUVFLWUhQQ2VpTVhBZjljdEZL
+            RDdZbVlGaVAzRU9MZFozYWJ2K3VRNTgKLS0tIG5pN0RiYUx3UDVhNklNTmEwQ3pz
+            L21MRDR6eXp6SGZhb2VEUWlKTURhaGMKMjLJnxz0kTqgkcZS3Un4ms//Bbs6NG2/
+            FTeUlPidELCHA3sGfudEBLqkT8C1psAN8aJQSNIuiPjQCHse4XWzpg==
+            -----END AGE ENCRYPTED FILE-----
+    lastmodified: "2026-10-18T11:46:42Z"
+    mac: ENC[AES256_GCM,data:NvTyiNraJ+pH7/qvFaGA0gqUdPtcV7e+Aqq5Y2d4skVoAi7hAGMT+E5r3ezsBvGHZ/0SATwK5YH73OptXWmhukDav99+6eBQkEM6HhYlNpCG8btepVFp5Q8gJgGT2oylwwAQoo+fP3qNBBYaZ0VzAZQ8SF+aqA8KOlskbNIxFe0=,iv:TOqlKe6hlcgRe3fq+4mHdABv2TYAOWbyeFBAEfUm4Is=,tag:G0/cASuaDfRbWvVDSuN0/w==,type:str]
+    pgp: []
+    unencrypted_suffix: _unencrypted
+    version: 3.9.0
+`
+
+func TestLoadYAMLFileSOPS(t *testing.T) {
+	setAgeIdentity(t, testAgeIdentity)
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "valid document",
+			content: sopsTestDocument,
+		},
+		{
+			name:    "added plaintext value",
+			content: strings.Replace(sopsTestDocument, "app:\n", "app:\n    extra: injected\n", 1),
+			wantErr: "MAC mismatch",
+		},
+		{
+			name:    "value moved to another key",
+			content: strings.Replace(sopsTestDocument, "    name: ENC", "    name_old: ENC", 1),
+			wantErr: "failed to decrypt app/name_old",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "secrets.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			source, err := loadSourceFile(path, LoadOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadSourceFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadSourceFile() error = %v", err)
+			}
+
+			if _, exists := source.Content[SOPSMetadataKey]; exists {
+				t.Error("sops metadata was not removed")
+			}
+
+			expected := map[string]string{
+				"app/name":        "myapp",
+				"app/db/password": "hunter2",
+				"app/db/port":     "5432",
+				"app/hosts":       "[a b]",
+			}
+			pairs := collectAllKVPairs([]*SourceFile{source})
+			if len(pairs) != len(expected) {
+				t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(expected), pairs)
+			}
+			for _, pair := range pairs {
+				if pair.Value != expected[pair.Key] {
+					t.Errorf("%s = %q, want %q", pair.Key, pair.Value, expected[pair.Key])
+				}
+				if !pair.Sensitive {
+					t.Errorf("%s is not marked sensitive", pair.Key)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadYAMLFileSOPSConfigKey(t *testing.T) {
+	// A sops key without the mac, lastmodified and version of real metadata is configuration
+	content := "sops:\n  enabled: true\n  age: age1recipient\napp:\n  name: myapp\n"
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadSourceFile(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	expected := map[string]string{
+		"app/name":     "myapp",
+		"sops/age":     "age1recipient",
+		"sops/enabled": "true",
+	}
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	if len(pairs) != len(expected) {
+		t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(expected), pairs)
+	}
+	for _, pair := range pairs {
+		if pair.Value != expected[pair.Key] || pair.Sensitive {
+			t.Errorf("%s = %q (sensitive %v), want %q", pair.Key, pair.Value, pair.Sensitive, expected[pair.Key])
+		}
+	}
+}
+
+func TestLoadYAMLFileSOPSWithoutIdentity(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setAgeIdentity(t, identity.String())
+
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	if err := os.WriteFile(path, []byte(sopsTestDocument), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = loadSourceFile(path, LoadOptions{})
+	if err == nil || !strings.Contains(err.Error(), "failed to decrypt sops data key") {
+		t.Fatalf("loadSourceFile() error = %v, want data key error", err)
+	}
+}
+
+func TestLoadYAMLFileEncryptedTag(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setAgeIdentity(t, identity.String())
+
+	content := "app:\n  name: myapp\n  password: " + encryptedTagValue(t, identity.Recipient(), "s3cr3t", "    ") + "\n"
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadSourceFile(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	for _, pair := range collectAllKVPairs([]*SourceFile{source}) {
+		switch pair.Key {
+		case "app/password":
+			if pair.Value != "s3cr3t" || !pair.Sensitive {
+				t.Errorf("app/password = (%q, sensitive=%v), want decrypted sensitive value", pair.Value, pair.Sensitive)
+			}
+		case "app/name":
+			if pair.Sensitive {
+				t.Error("app/name should not be sensitive")
+			}
+		}
+	}
+}
+
+// encryptedTagValue encrypts plaintext to recipient and returns it as an !encrypted block
+// scalar whose lines are indented by indent
+func encryptedTagValue(t *testing.T, recipient age.Recipient, plaintext, indent string) string {
+	t.Helper()
+
+	var ciphertext bytes.Buffer
+	armored := armor.NewWriter(&ciphertext)
+	writer, err := age.Encrypt(armored, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := armored.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return "!encrypted |\n" + indent + strings.ReplaceAll(strings.TrimSpace(ciphertext.String()), "\n", "\n"+indent)
+}
+
+// setAgeIdentity makes identity the only age key visible to the loader
+func setAgeIdentity(t *testing.T, identity string) {
+	t.Helper()
+	t.Setenv(SOPSAgeKeyEnv, identity)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(SOPSAgeKeyFileEnv, "")
+	os.Unsetenv(SOPSAgeKeyFileEnv)
+}
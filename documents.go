@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PrefixDirectiveKey sets the key prefix for the documents that follow, either as the only key of a
+// header document or as a "# kv-prefix: <prefix>" comment at the top of a document
+const PrefixDirectiveKey = "kv-prefix"
+
+var prefixDirectiveComment = regexp.MustCompile(`(?m)^#\s*` + PrefixDirectiveKey + `:[ \t]*(\S*)[ \t]*$`)
+
+// decodeDocuments returns every document in data, skipping empty documents that carry no prefix directive
+func decodeDocuments(data []byte) ([]*yaml.Node, error) {
+	var documents []*yaml.Node
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		document := &yaml.Node{}
+		err := decoder.Decode(document)
+		if errors.Is(err, io.EOF) {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(document.Content) == 0 {
+			continue
+		}
+		if _, ok := documentPrefix(document); isNullNode(document.Content[0]) && !ok {
+			continue
+		}
+
+		documents = append(documents, document)
+	}
+}
+
+// documentPrefix returns the prefix a document sets for itself and the documents after it
+func documentPrefix(document *yaml.Node) (string, bool) {
+	root := document.Content[0]
+
+	if prefix, ok := prefixHeader(root); ok {
+		return prefix, true
+	}
+
+	// Only head comments count: a directive followed by a blank line becomes the foot comment of the
+	// document before it, which it must not apply to
+	comments := []string{document.HeadComment, root.HeadComment}
+	if root.Kind == yaml.MappingNode && len(root.Content) > 0 {
+		comments = append(comments, root.Content[0].HeadComment)
+	}
+
+	for _, comment := range comments {
+		if match := prefixDirectiveComment.FindStringSubmatch(comment); match != nil {
+			return normalizePrefix(match[1]), true
+		}
+	}
+
+	return "", false
+}
+
+// prefixHeader returns the prefix of a header document, a mapping with kv-prefix as its only key
+func prefixHeader(root *yaml.Node) (string, bool) {
+	if root.Kind != yaml.MappingNode || len(root.Content) != 2 || root.Content[0].Value != PrefixDirectiveKey {
+		return "", false
+	}
+
+	value := root.Content[1]
+	if value.Kind != yaml.ScalarNode {
+		return "", false
+	}
+	if isNullNode(value) {
+		return "", true
+	}
+	return normalizePrefix(value.Value), true
+}
+
+// isHeaderDocument reports whether a document only sets the prefix
+func isHeaderDocument(document *yaml.Node) bool {
+	root := document.Content[0]
+	if _, ok := prefixHeader(root); ok {
+		return true
+	}
+	return isNullNode(root)
+}
+
+func isNullNode(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null"
+}
+
+func normalizePrefix(prefix string) string {
+	return strings.Trim(prefix, "/")
+}
+
+// mergeDocument adds the content of a document below prefix to the content of its file. It returns
+// the key of the first value that an earlier document already defines.
+func mergeDocument(content map[string]interface{}, prefix string, document map[string]interface{}) (string, bool) {
+	target := content
+	if prefix != "" {
+		segments := strings.Split(prefix, "/")
+		for i, segment := range segments {
+			switch next := target[segment].(type) {
+			case nil:
+				child := make(map[string]interface{})
+				target[segment] = child
+				target = child
+			case map[string]interface{}:
+				target = next
+			default:
+				return strings.Join(segments[:i+1], "/"), false
+			}
+		}
+	}
+
+	return mergeMaps(target, document, prefix)
+}
+
+func mergeMaps(dst, src map[string]interface{}, prefix string) (string, bool) {
+	for _, key := range sortedKeys(src) {
+		value := src[key]
+		existing, exists := dst[key]
+		if !exists {
+			dst[key] = value
+			continue
+		}
+
+		existingMap, ok1 := existing.(map[string]interface{})
+		valueMap, ok2 := value.(map[string]interface{})
+		if !ok1 || !ok2 {
+			return buildKey(prefix, key), false
+		}
+
+		if conflict, ok := mergeMaps(existingMap, valueMap, buildKey(prefix, key)); !ok {
+			return conflict, false
+		}
+	}
+
+	return "", true
+}
+
+// documentConflictError reports a key defined by more than one document of a file
+func documentConflictError(key string, previous, current map[string]KeyInfo) error {
+	return fmt.Errorf("line %d: key '%s' is already defined by an earlier document at line %d",
+		keyLine(current, key), key, keyLine(previous, key))
+}
+
+// keyLine returns the line of a key, or of its first child when the key is only a parent
+func keyLine(keys map[string]KeyInfo, key string) int {
+	if info, ok := keys[key]; ok {
+		return info.Line
+	}
+
+	line := 0
+	for path, info := range keys {
+		if strings.HasPrefix(path, key+"/") && (line == 0 || info.Line < line) {
+			line = info.Line
+		}
+	}
+	return line
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadYAMLFileMultiDocument(t *testing.T) {
+	content := `app:
+  name: myapp
+---
+# kv-prefix: services/api
+port: 8080
+replicas: 2
+---
+kv-prefix: services/worker
+---
+queue: jobs
+---
+threads: 4
+--- # kv-prefix: /
+app:
+  region: eu
+`
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadSourceFile(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	expected := map[string]KVPair{
+		"app/name":                {Value: "myapp", Line: 2},
+		"services/api/port":       {Value: "8080", Line: 5},
+		"services/api/replicas":   {Value: "2", Line: 6},
+		"services/worker/queue":   {Value: "jobs", Line: 10},
+		"services/worker/threads": {Value: "4", Line: 12},
+		"app/region":              {Value: "eu", Line: 15},
+	}
+
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	if len(pairs) != len(expected) {
+		t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(expected), pairs)
+	}
+	for _, pair := range pairs {
+		want := expected[pair.Key]
+		if pair.Value != want.Value || pair.Line != want.Line {
+			t.Errorf("%s = %q at line %d, want %q at line %d", pair.Key, pair.Value, pair.Line, want.Value, want.Line)
+		}
+	}
+}
+
+func TestLoadYAMLFileDetachedPrefixComment(t *testing.T) {
+	// The blank line detaches the comment, which yaml.v3 then attaches to the first document
+	content := "app:\n  name: myapp\n---\n# kv-prefix: services/api\n\nport: 8080\n"
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadSourceFile(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	if len(pairs) != 2 || pairs[0].Key != "app/name" || pairs[1].Key != "port" {
+		t.Errorf("pairs = %+v, want app/name and port", pairs)
+	}
+}
+
+func TestLoadYAMLFileMultiDocumentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		opts     LoadOptions
+		wantErr  string
+		wantLine int
+	}{
+		{
+			name:     "same key in two documents",
+			content:  "app:\n  name: a\n---\napp:\n  name: b\n",
+			wantErr:  "key 'app/name' is already defined by an earlier document at line 2",
+			wantLine: 5,
+		},
+		{
+			name:     "prefix below a value",
+			content:  "app: value\n---\n# kv-prefix: app/config\nkey: x\n",
+			wantErr:  "key 'app' is already defined by an earlier document at line 1",
+			wantLine: 4,
+		},
+		{
+			name:     "multi-document files disabled",
+			content:  "a: 1\n---\nb: 2\n",
+			opts:     LoadOptions{SingleDocument: true},
+			wantErr:  "file contains 2 YAML documents but multi-document files are disabled",
+			wantLine: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := loadSourceFile(path, tt.opts)
+			var diagErr *DiagnosticError
+			if !errors.As(err, &diagErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadSourceFile() error = %v, want %q", err, tt.wantErr)
+			}
+			if line := diagErr.Diagnostics[0].Line; line != tt.wantLine {
+				t.Errorf("diagnostic line = %d, want %d", line, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestLoadYAMLFileSingleDocumentAllowed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte("---\n# kv-prefix: app\nname: myapp\n...\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadSourceFile(path, LoadOptions{SingleDocument: true})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+	if pairs := collectAllKVPairs([]*SourceFile{source}); len(pairs) != 1 || pairs[0].Key != "app/name" {
+		t.Errorf("pairs = %+v, want app/name", pairs)
+	}
+}
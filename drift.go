@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrDriftDetected is returned when Consul does not match the desired KV pairs
+var ErrDriftDetected = errors.New("drift detected")
+
+// checkDrift compares the desired pairs with the live values in Consul and prints a report
+func checkDrift(ctx context.Context, client *ConsulClient, pairs []KVPair, includeExtra bool) error {
+	live, err := fetchKeySpace(ctx, client, pairs)
+	if err != nil {
+		return fmt.Errorf("failed to read current values: %w", err)
+	}
+
+	report := compareKeySpace(pairs, live, includeExtra)
+	fmt.Println(formatDriftReport(report))
+
+	if report.HasDrift() {
+		return fmt.Errorf("%w: %d keys differ", ErrDriftDetected, report.Count())
+	}
+
+	return nil
+}
+
+// compareKeySpace computes which desired keys are missing or different in Consul and,
+// optionally, which keys exist in Consul but are not desired
+func compareKeySpace(desired, live []KVPair, includeExtra bool) DriftReport {
+	liveValues := make(map[string]KVPair, len(live))
+	for _, pair := range live {
+		liveValues[pair.Key] = pair
+	}
+
+	desiredKeys := make(map[string]bool, len(desired))
+	report := DriftReport{}
+
+	for _, pair := range desired {
+		desiredKeys[pair.Key] = true
+
+		actual, exists := liveValues[pair.Key]
+		switch {
+		case !exists:
+			report.Missing = append(report.Missing, pair)
+		case actual.Value != pair.Value || actual.Flags != pair.Flags:
+			report.Changed = append(report.Changed, DriftChange{
+				Key:           pair.Key,
+				Expected:      pair.Value,
+				Actual:        actual.Value,
+				ExpectedFlags: pair.Flags,
+				ActualFlags:   actual.Flags,
+				Sensitive:     pair.Sensitive,
+			})
+		}
+	}
+
+	if includeExtra {
+		for _, pair := range live {
+			// Folder placeholders are created implicitly and are not drift
+			if !desiredKeys[pair.Key] && !strings.HasSuffix(pair.Key, "/") {
+				report.Extra = append(report.Extra, pair)
+			}
+		}
+	}
+
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].Key < report.Missing[j].Key })
+	sort.Slice(report.Changed, func(i, j int) bool { return report.Changed[i].Key < report.Changed[j].Key })
+	sort.Slice(report.Extra, func(i, j int) bool { return report.Extra[i].Key < report.Extra[j].Key })
+
+	return report
+}
+
+// planSync compares the desired pairs with the existing ones and decides which pairs need to be written.
+// A pair whose value is unchanged but whose flags differ is written as well.
+func planSync(desired, existing []KVPair) SyncPlan {
+	existingPairs := make(map[string]KVPair, len(existing))
+	for _, pair := range existing {
+		existingPairs[pair.Key] = pair
+	}
+
+	plan := SyncPlan{}
+	for _, pair := range desired {
+		current, exists := existingPairs[pair.Key]
+		switch {
+		case !exists:
+			plan.Added = append(plan.Added, pair)
+			plan.Pending = append(plan.Pending, pair)
+		case current.Value != pair.Value || current.Flags != pair.Flags:
+			plan.Changed = append(plan.Changed, pair)
+			plan.Pending = append(plan.Pending, pair)
+		default:
+			plan.Unchanged = append(plan.Unchanged, pair)
+		}
+	}
+
+	return plan
+}
+
+// HasDrift reports whether any difference was found
+func (r DriftReport) HasDrift() bool {
+	return r.Count() > 0
+}
+
+// Count returns the number of differing keys
+func (r DriftReport) Count() int {
+	return len(r.Missing) + len(r.Changed) + len(r.Extra)
+}
+
+// formatDriftReport formats the drift report for display
+func formatDriftReport(report DriftReport) string {
+	var sb strings.Builder
+
+	sb.WriteString("\n" + strings.Repeat("=", 60) + "\n")
+	sb.WriteString("Drift Report\n")
+	sb.WriteString(strings.Repeat("=", 60) + "\n")
+
+	if len(report.Missing) > 0 {
+		sb.WriteString(fmt.Sprintf("\nMissing in Consul (%d):\n", len(report.Missing)))
+		for _, pair := range report.Missing {
+			sb.WriteString(fmt.Sprintf("  - %s\n", pair.Key))
+		}
+	}
+
+	if len(report.Changed) > 0 {
+		sb.WriteString(fmt.Sprintf("\nDifferent in Consul (%d):\n", len(report.Changed)))
+		for _, change := range report.Changed {
+			sb.WriteString(fmt.Sprintf("  - %s\n", change.Key))
+			if change.Expected != change.Actual {
+				sb.WriteString(fmt.Sprintf("      expected: %s\n", displayValue(change.Expected, change.Sensitive)))
+				sb.WriteString(fmt.Sprintf("      actual:   %s\n", displayValue(change.Actual, change.Sensitive)))
+			}
+			if change.ExpectedFlags != change.ActualFlags {
+				sb.WriteString(fmt.Sprintf("      expected flags: %d\n", change.ExpectedFlags))
+				sb.WriteString(fmt.Sprintf("      actual flags:   %d\n", change.ActualFlags))
+			}
+		}
+	}
+
+	if len(report.Extra) > 0 {
+		sb.WriteString(fmt.Sprintf("\nExtra in Consul (%d):\n", len(report.Extra)))
+		for _, pair := range report.Extra {
+			sb.WriteString(fmt.Sprintf("  - %s\n", pair.Key))
+		}
+	}
+
+	if report.HasDrift() {
+		sb.WriteString(fmt.Sprintf("\n[DRIFT] %d keys in Consul differ from the desired state.\n", report.Count()))
+	} else {
+		sb.WriteString("\n[OK] Consul matches the desired state.\n")
+	}
+
+	return sb.String()
+}
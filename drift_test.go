@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompareKeySpace(t *testing.T) {
+	desired := []KVPair{
+		{Key: "app/port", Value: "8080"},
+		{Key: "app/name", Value: "myapp"},
+		{Key: "app/host", Value: "localhost"},
+		{Key: "app/mode", Value: "json", Flags: 2},
+	}
+	live := []KVPair{
+		{Key: "app/", Value: ""},
+		{Key: "app/name", Value: "myapp"},
+		{Key: "app/port", Value: "80"},
+		{Key: "app/legacy", Value: "old"},
+		{Key: "app/mode", Value: "json", Flags: 1},
+	}
+
+	expected := DriftReport{
+		Missing: []KVPair{{Key: "app/host", Value: "localhost"}},
+		Changed: []DriftChange{
+			{Key: "app/mode", Expected: "json", Actual: "json", ExpectedFlags: 2, ActualFlags: 1},
+			{Key: "app/port", Expected: "8080", Actual: "80"},
+		},
+	}
+
+	report := compareKeySpace(desired, live, false)
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("compareKeySpace() = %+v, want %+v", report, expected)
+	}
+
+	expected.Extra = []KVPair{{Key: "app/legacy", Value: "old"}}
+	report = compareKeySpace(desired, live, true)
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("compareKeySpace(includeExtra) = %+v, want %+v", report, expected)
+	}
+	if report.Count() != 4 {
+		t.Errorf("Count() = %d, want 4", report.Count())
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	fake, server := newFakeConsul(t, map[string]string{
+		"app/name": "myapp",
+		"app/port": "80",
+	})
+	client := NewConsulClient(server.URL, DefaultDatacenter)
+
+	pairs := []KVPair{
+		{Key: "app/name", Value: "myapp"},
+		{Key: "app/port", Value: "8080"},
+	}
+
+	err := checkDrift(context.Background(), client, pairs, false)
+	if !errors.Is(err, ErrDriftDetected) {
+		t.Fatalf("checkDrift() error = %v, want ErrDriftDetected", err)
+	}
+
+	if fake.data["app/port"] != "80" {
+		t.Error("checkDrift() must never write to Consul")
+	}
+
+	fake.data["app/port"] = "8080"
+	if err := checkDrift(context.Background(), client, pairs, false); err != nil {
+		t.Errorf("checkDrift() without drift error = %v", err)
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	desired := []KVPair{
+		{Key: "app/port", Value: "8080"},
+		{Key: "app/name", Value: "myapp"},
+		{Key: "app/host", Value: "localhost"},
+		{Key: "app/mode", Value: "json", Flags: 2},
+	}
+	existing := []KVPair{
+		{Key: "app/name", Value: "myapp"},
+		{Key: "app/port", Value: "80"},
+		{Key: "app/mode", Value: "json"},
+	}
+
+	expected := SyncPlan{
+		Added:     []KVPair{{Key: "app/host", Value: "localhost"}},
+		Changed:   []KVPair{{Key: "app/port", Value: "8080"}, {Key: "app/mode", Value: "json", Flags: 2}},
+		Unchanged: []KVPair{{Key: "app/name", Value: "myapp"}},
+		Pending: []KVPair{
+			{Key: "app/port", Value: "8080"},
+			{Key: "app/host", Value: "localhost"},
+			{Key: "app/mode", Value: "json", Flags: 2},
+		},
+	}
+
+	if plan := planSync(desired, existing); !reflect.DeepEqual(plan, expected) {
+		t.Errorf("planSync() = %+v, want %+v", plan, expected)
+	}
+}
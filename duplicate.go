@@ -6,24 +6,18 @@ import (
 	"strings"
 )
 
-// detectDuplicates checks for duplicate keys across all YAML files
-func detectDuplicates(kvMaps []map[string]interface{}, filenames []string) ([]DuplicateInfo, error) {
-	if len(kvMaps) != len(filenames) {
-		return nil, fmt.Errorf("mismatch between number of KV maps (%d) and filenames (%d)", len(kvMaps), len(filenames))
-	}
-
+// detectSourceDuplicates checks for duplicate keys across all loaded files
+func detectSourceDuplicates(sources []*SourceFile) []DuplicateInfo {
 	keyTracker := make(map[string][]FileSource)
 
 	// Collect all keys from all files
-	for i, kvMap := range kvMaps {
-		// Flatten the map to get all keys
-		pairs := flattenKVPairs(kvMap, "")
-		for _, pair := range pairs {
-			keyTracker[pair.Key] = append(keyTracker[pair.Key], FileSource{
-				Filename: filenames[i],
-				Value:    pair.Value,
-			})
-		}
+	for _, pair := range collectAllKVPairs(sources) {
+		keyTracker[pair.Key] = append(keyTracker[pair.Key], FileSource{
+			Filename:  pair.File,
+			Line:      pair.Line,
+			Value:     pair.Value,
+			Sensitive: pair.Sensitive,
+		})
 	}
 
 	// Find duplicates
@@ -42,7 +36,7 @@ func detectDuplicates(kvMaps []map[string]interface{}, filenames []string) ([]Du
 		return duplicates[i].Key < duplicates[j].Key
 	})
 
-	return duplicates, nil
+	return duplicates
 }
 
 // formatDuplicateError formats duplicate information into an error message
@@ -53,7 +47,7 @@ func formatDuplicateError(duplicates []DuplicateInfo) string {
 	for _, dup := range duplicates {
 		sb.WriteString(fmt.Sprintf("Key: \"%s\"\n", dup.Key))
 		for _, file := range dup.Files {
-			sb.WriteString(fmt.Sprintf("  - File: %s, Value: \"%v\"\n", file.Filename, file.Value))
+			sb.WriteString(fmt.Sprintf("  - File: %s, Value: \"%v\"\n", formatLocation(file.Filename, file.Line), fileSourceValue(file)))
 		}
 		sb.WriteString("\n")
 	}
@@ -63,3 +57,16 @@ func formatDuplicateError(duplicates []DuplicateInfo) string {
 
 	return sb.String()
 }
+
+// formatLocation formats a file and line as file:line, or just the file when the line is unknown
+func formatLocation(filename string, line int) string {
+	if line <= 0 {
+		return filename
+	}
+	return fmt.Sprintf("%s:%d", filename, line)
+}
+
+// fileSourceValue returns the value of a duplicate definition as it may be displayed
+func fileSourceValue(file FileSource) string {
+	return displayValue(fmt.Sprintf("%v", file.Value), file.Sensitive)
+}
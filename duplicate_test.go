@@ -5,12 +5,11 @@ import (
 	"testing"
 )
 
-func TestDetectDuplicates(t *testing.T) {
+func TestDetectSourceDuplicates(t *testing.T) {
 	tests := []struct {
 		name         string
 		kvMaps       []map[string]interface{}
 		filenames    []string
-		wantError    bool
 		dupCount     int
 		expectedKeys []string
 	}{
@@ -21,7 +20,6 @@ func TestDetectDuplicates(t *testing.T) {
 				{"key2": "value2"},
 			},
 			filenames:    []string{"file1.yaml", "file2.yaml"},
-			wantError:    false,
 			dupCount:     0,
 			expectedKeys: []string{},
 		},
@@ -38,7 +36,6 @@ func TestDetectDuplicates(t *testing.T) {
 				},
 			},
 			filenames:    []string{"file1.yaml", "file2.yaml"},
-			wantError:    false,
 			dupCount:     1,
 			expectedKeys: []string{"key1"},
 		},
@@ -58,7 +55,6 @@ func TestDetectDuplicates(t *testing.T) {
 				},
 			},
 			filenames:    []string{"file1.yaml", "file2.yaml"},
-			wantError:    false,
 			dupCount:     1,
 			expectedKeys: []string{"app/name"},
 		},
@@ -84,7 +80,6 @@ func TestDetectDuplicates(t *testing.T) {
 				},
 			},
 			filenames:    []string{"config1.yaml", "config2.yaml"},
-			wantError:    false,
 			dupCount:     2,
 			expectedKeys: []string{"db/host", "cache/ttl"},
 		},
@@ -96,37 +91,21 @@ func TestDetectDuplicates(t *testing.T) {
 				{"shared": "value3"},
 			},
 			filenames:    []string{"file1.yaml", "file2.yaml", "file3.yaml"},
-			wantError:    false,
 			dupCount:     1,
 			expectedKeys: []string{"shared"},
 		},
-		{
-			name:      "mismatched kvMaps and filenames",
-			kvMaps:    []map[string]interface{}{{"key": "value"}},
-			filenames: []string{"file1.yaml", "file2.yaml"},
-			wantError: true,
-			dupCount:  0,
-		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			duplicates, err := detectDuplicates(tt.kvMaps, tt.filenames)
-
-			if tt.wantError {
-				if err == nil {
-					t.Errorf("detectDuplicates() expected error but got none")
-				}
-				return
-			}
-
-			if err != nil {
-				t.Errorf("detectDuplicates() unexpected error: %v", err)
-				return
+			sources := make([]*SourceFile, len(tt.kvMaps))
+			for i, kvMap := range tt.kvMaps {
+				sources[i] = &SourceFile{Path: tt.filenames[i], Content: kvMap}
 			}
+			duplicates := detectSourceDuplicates(sources)
 
 			if len(duplicates) != tt.dupCount {
-				t.Errorf("detectDuplicates() returned %d duplicates, want %d", len(duplicates), tt.dupCount)
+				t.Errorf("detectSourceDuplicates() returned %d duplicates, want %d", len(duplicates), tt.dupCount)
 			}
 
 			// Check if the expected keys are found
@@ -139,7 +118,7 @@ func TestDetectDuplicates(t *testing.T) {
 					}
 				}
 				if !found {
-					t.Errorf("detectDuplicates() did not find expected duplicate key: %s", expectedKey)
+					t.Errorf("detectSourceDuplicates() did not find expected duplicate key: %s", expectedKey)
 				}
 			}
 
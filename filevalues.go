@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FileTag replaces a value with the verbatim content of a file
+	FileTag = "!file"
+
+	// DefaultMaxValueSize is the default limit of Consul for a single value (kv_max_value_size)
+	DefaultMaxValueSize = 512 * 1024
+)
+
+// resolveFileValues replaces every !file value below node with the content of the referenced file
+// and records the file in values. Paths are relative to filePath, the file containing node.
+func resolveFileValues(node *yaml.Node, filePath string, included, values map[*yaml.Node]string) error {
+	if includedPath, ok := included[node]; ok {
+		filePath = includedPath
+	}
+
+	if node.Tag != FileTag {
+		for _, child := range node.Content {
+			if err := resolveFileValues(child, filePath, included, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if node.Kind != yaml.ScalarNode || node.Value == "" {
+		return fmt.Errorf("line %d: %s expects a file path", node.Line, FileTag)
+	}
+
+	path := node.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(filePath), path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("line %d: failed to read %s: %w", node.Line, node.Value, err)
+	}
+
+	*node = yaml.Node{
+		Kind:   yaml.ScalarNode,
+		Tag:    "!!str",
+		Value:  string(data),
+		Line:   node.Line,
+		Column: node.Column,
+	}
+	values[node] = path
+	return nil
+}
+
+// loadFileValues reads the files of the file_values setting of an environment into a source.
+// Keys are used as they are written and paths are resolved like the files of the environment.
+func loadFileValues(configPath string, fileValues FileValues) (*SourceFile, error) {
+	source := &SourceFile{
+		Path:    configPath,
+		Content: make(map[string]interface{}),
+		Keys:    make(map[string]KeyInfo),
+	}
+
+	paths := make([]string, len(fileValues))
+	for i, fileValue := range fileValues {
+		paths[i] = fileValue.Path
+	}
+
+	for i, path := range resolveFilePaths(configPath, paths) {
+		fileValue := fileValues[i]
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, loadDiagnosticError(configPath, "load file_values of",
+				fmt.Errorf("line %d: %s: %w", fileValue.Line, fileValue.Key, err))
+		}
+
+		if existing, exists := source.Keys[fileValue.Key]; exists {
+			return nil, loadDiagnosticError(configPath, "load file_values of",
+				fmt.Errorf("line %d: key '%s' is already defined at line %d", fileValue.Line, fileValue.Key, existing.Line))
+		}
+
+		source.Content[fileValue.Key] = string(data)
+		source.Keys[fileValue.Key] = KeyInfo{File: configPath, Line: fileValue.Line, ValueFile: path}
+	}
+
+	return source, nil
+}
+
+// checkValueSizes reports every value larger than limit bytes, which Consul would reject.
+// A limit of zero disables the check.
+func checkValueSizes(pairs []KVPair, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	var diagnostics []Diagnostic
+	for _, pair := range pairs {
+		if len(pair.Value) <= limit {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Category: CategoryValueSize,
+			File:     pair.File,
+			Line:     pair.Line,
+			Key:      pair.Key,
+			Message:  fmt.Sprintf("%s: value is %d bytes, more than the limit of %d bytes", pair.Key, len(pair.Value), limit),
+		})
+	}
+
+	return diagnosticListError("%d values exceed the size limit", diagnostics)
+}
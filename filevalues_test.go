@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadYAMLFileFileValues(t *testing.T) {
+	binary := "\x89PNG\r\n\x1a\n\x00\xff"
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"app.yaml":                "tls:\n  cert: !file certs/api.pem\n  logo: !file logo.png\nshared: !include shared/lua.yaml\n",
+		"certs/api.pem":           "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+		"logo.png":                binary,
+		"shared/lua.yaml":         "script: !file scripts/init.lua\n",
+		"shared/scripts/init.lua": "local x = \"${NOT_INTERPOLATED}\"\n",
+	})
+
+	source, err := loadSourceFile(filepath.Join(dir, "app.yaml"), LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	if err := interpolatePairs(pairs, true); err != nil {
+		t.Fatalf("interpolatePairs() error = %v", err)
+	}
+
+	expected := map[string]KVPair{
+		"tls/cert":      {Value: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n", Line: 2, ValueFile: filepath.Join(dir, "certs/api.pem")},
+		"tls/logo":      {Value: binary, Line: 3, ValueFile: filepath.Join(dir, "logo.png")},
+		"shared/script": {Value: "local x = \"${NOT_INTERPOLATED}\"\n", Line: 1, ValueFile: filepath.Join(dir, "shared/scripts/init.lua")},
+	}
+	if len(pairs) != len(expected) {
+		t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(expected), pairs)
+	}
+	for _, pair := range pairs {
+		want := expected[pair.Key]
+		if pair.Value != want.Value || pair.Line != want.Line || pair.ValueFile != want.ValueFile {
+			t.Errorf("%s = %q at line %d from %q, want %q at line %d from %q",
+				pair.Key, pair.Value, pair.Line, pair.ValueFile, want.Value, want.Line, want.ValueFile)
+		}
+	}
+
+	ops := createTransactionOps(pairs)
+	for _, op := range ops {
+		if op.KV.Key == "tls/logo" && op.KV.Value != encodeValue(binary) {
+			t.Errorf("binary value encoded as %q", op.KV.Value)
+		}
+	}
+}
+
+func TestLoadYAMLFileFileValueErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantErr  string
+		wantLine int
+	}{
+		{
+			name:     "missing file",
+			content:  "a: 1\ncert: !file missing.pem\n",
+			wantErr:  "failed to read missing.pem",
+			wantLine: 2,
+		},
+		{
+			name:     "not a path",
+			content:  "cert: !file\n  a: 1\n",
+			wantErr:  "!file expects a file path",
+			wantLine: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, t.TempDir(), map[string]string{"app.yaml": tt.content})
+
+			_, err := loadSourceFile(filepath.Join(dir, "app.yaml"), LoadOptions{})
+			var diagErr *DiagnosticError
+			if !errors.As(err, &diagErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadSourceFile() error = %v, want %q", err, tt.wantErr)
+			}
+			if line := diagErr.Diagnostics[0].Line; line != tt.wantLine {
+				t.Errorf("diagnostic line = %d, want %d", line, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestLoadFileValues(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"kv-files/certs/api.pem": "PEM\n",
+		"nginx.conf":             "server {}\n",
+	})
+	configPath := filepath.Join(dir, "environments.yaml")
+
+	var env Environment
+	config := "files: [app.yaml]\nfile_values:\n  /certs/api.pem: certs/api.pem\n  nginx/snippet: " + filepath.Join(dir, "nginx.conf") + "\n"
+	if err := yaml.Unmarshal([]byte(config), &env); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	source, err := loadFileValues(configPath, env.FileValues)
+	if err != nil {
+		t.Fatalf("loadFileValues() error = %v", err)
+	}
+
+	expected := map[string]KVPair{
+		"certs/api.pem": {Value: "PEM\n", Line: 3},
+		"nginx/snippet": {Value: "server {}\n", Line: 4},
+	}
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	if len(pairs) != len(expected) {
+		t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(expected), pairs)
+	}
+	for _, pair := range pairs {
+		want := expected[pair.Key]
+		if pair.Value != want.Value || pair.File != configPath || pair.Line != want.Line || pair.ValueFile == "" {
+			t.Errorf("%s = %q at %s:%d from %q, want %q at line %d", pair.Key, pair.Value, pair.File, pair.Line, pair.ValueFile, want.Value, want.Line)
+		}
+	}
+
+	env.FileValues = append(env.FileValues, FileValue{Key: "missing", Path: "missing.pem", Line: 5})
+	if _, err := loadFileValues(configPath, env.FileValues); err == nil || !strings.Contains(err.Error(), "line 5: missing") {
+		t.Errorf("loadFileValues() error = %v, want missing file at line 5", err)
+	}
+}
+
+func TestCheckValueSizes(t *testing.T) {
+	pairs := []KVPair{
+		{Key: "small", Value: "1234", File: "a.yaml", Line: 1},
+		{Key: "exact", Value: "12345", File: "a.yaml", Line: 2},
+		{Key: "large", Value: "123456", File: "a.yaml", Line: 3},
+	}
+
+	if err := checkValueSizes(pairs, 0); err != nil {
+		t.Errorf("checkValueSizes() with the check disabled error = %v", err)
+	}
+
+	err := checkValueSizes(pairs, 5)
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) {
+		t.Fatalf("checkValueSizes() error = %v, want a DiagnosticError", err)
+	}
+	if len(diagErr.Diagnostics) != 1 || diagErr.Diagnostics[0].Key != "large" || diagErr.Diagnostics[0].Line != 3 {
+		t.Errorf("diagnostics = %+v, want one for large at line 3", diagErr.Diagnostics)
+	}
+	if !strings.Contains(err.Error(), "value is 6 bytes, more than the limit of 5 bytes") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestDisplayValueBinary(t *testing.T) {
+	if got := displayValue("\xff\x00", false); got != "<binary, 2 bytes>" {
+		t.Errorf("displayValue(binary) = %q", got)
+	}
+	if got := displayValue("\xff\x00", true); got != RedactedValue {
+		t.Errorf("displayValue(binary, sensitive) = %q", got)
+	}
+	if got := displayValue("héllo", false); got != "héllo" {
+		t.Errorf("displayValue(text) = %q", got)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FlagsTagPrefix sets the Consul flags of a value, or of every key in a subtree: !flags:42
+const FlagsTagPrefix = "!flags:"
+
+// flagsTag returns the flags set by a !flags:N tag on a value. N may be decimal, or hexadecimal with 0x.
+// The tag replaces the node's only tag, so a tagged scalar is kept as written and keys that need another
+// tag like !secret or !file get their flags from the environment's flags rules instead.
+func flagsTag(node *yaml.Node) (uint64, bool, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	value, ok := strings.CutPrefix(node.Tag, FlagsTagPrefix)
+	if !ok {
+		return 0, false, nil
+	}
+
+	flags, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("line %d: invalid flags in tag %s: must be an unsigned 64-bit integer", node.Line, node.Tag)
+	}
+	return flags, true, nil
+}
+
+// match returns the flags of the first rule whose pattern matches key
+func (r FlagRules) match(key string) (uint64, bool) {
+	for _, rule := range r {
+		if matchKeyPattern(rule.Pattern, key) {
+			return rule.Flags, true
+		}
+	}
+	return 0, false
+}
+
+// applyFlagRules sets the flags of every key of the sources that matches a rule,
+// unless a !flags:N tag already set them
+func applyFlagRules(sources []*SourceFile, rules FlagRules) {
+	if len(rules) == 0 {
+		return
+	}
+
+	for _, source := range sources {
+		for _, pair := range flattenKVPairs(source.Content, "") {
+			info := source.keyInfo(pair.Key)
+			if info.HasFlags {
+				continue
+			}
+			if flags, ok := rules.match(pair.Key); ok {
+				info.Flags = flags
+				info.HasFlags = true
+				source.Keys[pair.Key] = info
+			}
+		}
+	}
+}
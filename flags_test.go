@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		rules    FlagRules
+		expected map[string]uint64
+	}{
+		{
+			name: "tags",
+			files: map[string]string{"app.yaml": `app:
+  name: myapp
+  mode: !flags:1 json
+  codecs: !flags:0x10
+    a: x
+    b: !flags:3 y
+    nested:
+      c: z
+`},
+			expected: map[string]uint64{
+				"app/name":            0,
+				"app/mode":            1,
+				"app/codecs/a":        16,
+				"app/codecs/b":        3,
+				"app/codecs/nested/c": 16,
+			},
+		},
+		{
+			name:  "rules",
+			files: map[string]string{"app.json": `{"app": {"name": "myapp", "codecs": {"a": "x", "b": "y"}}}`},
+			rules: FlagRules{
+				{Pattern: "app/codecs/b", Flags: 5},
+				{Pattern: "app/codecs/*", Flags: 4},
+			},
+			expected: map[string]uint64{
+				"app/name":     0,
+				"app/codecs/a": 4,
+				"app/codecs/b": 5,
+			},
+		},
+		{
+			name:  "tags take precedence over rules",
+			files: map[string]string{"app.yaml": "a: !flags:0 x\nb: y\n"},
+			rules: FlagRules{{Pattern: "*", Flags: 9}},
+			expected: map[string]uint64{
+				"a": 0,
+				"b": 9,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, t.TempDir(), tt.files)
+
+			var paths []string
+			for name := range tt.files {
+				paths = append(paths, filepath.Join(dir, name))
+			}
+			sources, err := loadAllSourceFiles(fileEntries(paths...), LoadOptions{})
+			if err != nil {
+				t.Fatalf("loadAllSourceFiles() error = %v", err)
+			}
+			applyFlagRules(sources, tt.rules)
+
+			pairs := collectAllKVPairs(sources)
+			if len(pairs) != len(tt.expected) {
+				t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(tt.expected), pairs)
+			}
+			for _, pair := range pairs {
+				if want, ok := tt.expected[pair.Key]; !ok || pair.Flags != want {
+					t.Errorf("%s has flags %d, want %d", pair.Key, pair.Flags, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFlagsErrors(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{"app.yaml": "a: 1\nb: !flags:abc x\n"})
+
+	_, err := loadSourceFile(filepath.Join(dir, "app.yaml"), LoadOptions{})
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) || !strings.Contains(err.Error(), "invalid flags in tag !flags:abc") {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+	if line := diagErr.Diagnostics[0].Line; line != 2 {
+		t.Errorf("diagnostic line = %d, want 2", line)
+	}
+
+	var env Environment
+	err = yaml.Unmarshal([]byte("files: [a.yaml]\nflags:\n  app/*: -1\n"), &env)
+	if err == nil || !strings.Contains(err.Error(), "line 3: flags of 'app/*' must be an unsigned 64-bit integer") {
+		t.Errorf("Unmarshal() error = %v", err)
+	}
+}
+
+func TestFlagsRoundTrip(t *testing.T) {
+	pairs := []KVPair{
+		{Key: "app/mode", Value: "json", Flags: 1},
+		{Key: "app/port", Value: "8080", Flags: 2},
+		{Key: "app/enabled", Value: "true", Flags: 3},
+		{Key: "app/script", Value: "#!/bin/sh\necho hello\n", Flags: 18446744073709551615},
+		{Key: "app/plain", Value: "x"},
+	}
+
+	t.Run("export and import", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeConsulJSON(&buf, pairs); err != nil {
+			t.Fatalf("writeConsulJSON() error = %v", err)
+		}
+
+		imported, err := decodeExport(&buf, "export.json")
+		if err != nil {
+			t.Fatalf("decodeExport() error = %v", err)
+		}
+		for i, pair := range imported {
+			if pair.Key != pairs[i].Key || pair.Value != pairs[i].Value || pair.Flags != pairs[i].Flags {
+				t.Errorf("imported %+v, want %+v", pair, pairs[i])
+			}
+		}
+	})
+
+	t.Run("pull", func(t *testing.T) {
+		files, err := generateYAMLFiles(pairs, "app", false)
+		if err != nil {
+			t.Fatalf("generateYAMLFiles() error = %v", err)
+		}
+
+		dir := writeFiles(t, t.TempDir(), map[string]string{"app.yaml": string(files[0].Content)})
+		source, err := loadSourceFile(filepath.Join(dir, "app.yaml"), LoadOptions{})
+		if err != nil {
+			t.Fatalf("loadSourceFile() error = %v\n%s", err, files[0].Content)
+		}
+
+		loaded := make(map[string]KVPair)
+		for _, pair := range collectAllKVPairs([]*SourceFile{source}) {
+			loaded[pair.Key] = pair
+		}
+		for _, want := range pairs {
+			got := loaded[want.Key]
+			if got.Value != want.Value || got.Flags != want.Flags {
+				t.Errorf("%s = %q with flags %d, want %q with flags %d\n%s", want.Key, got.Value, got.Flags, want.Value, want.Flags, files[0].Content)
+			}
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dotenvEscapes are the escape sequences understood in double-quoted .env values
+var dotenvEscapes = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`, `\$`, "$")
+
+// parseDotenvFile parses a .env file of KEY=VALUE lines. Keys are used as they are, without nesting.
+// Lines may start with "export", values may be single- or double-quoted, and double-quoted values
+// may span several lines.
+func parseDotenvFile(filePath string, data []byte, _ LoadOptions) (*SourceFile, error) {
+	builder := newSourceBuilder(filePath)
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "export "); ok {
+			line = strings.TrimLeft(rest, " \t")
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, loadDiagnosticError(filePath, "parse .env file", fmt.Errorf("line %d: expected KEY=VALUE", lineNumber))
+		}
+
+		value, consumed, err := parseDotenvValue(strings.TrimLeft(value, " \t"), lines[i+1:])
+		if err != nil {
+			return nil, loadDiagnosticError(filePath, "parse .env file", fmt.Errorf("line %d: %s: %w", lineNumber, key, err))
+		}
+		i += consumed
+
+		if err := builder.set([]string{key}, value, lineNumber); err != nil {
+			return nil, loadDiagnosticError(filePath, "load", err)
+		}
+	}
+
+	return builder.source, nil
+}
+
+// parseDotenvValue parses the value after the equals sign. It returns the value and the number
+// of following lines a multi-line double-quoted value took.
+func parseDotenvValue(value string, following []string) (string, int, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		text := value[1:]
+		consumed := 0
+		for {
+			if end := closingQuote(text); end >= 0 {
+				if err := checkDotenvTrailer(text[end+1:]); err != nil {
+					return "", 0, err
+				}
+				return dotenvEscapes.Replace(text[:end]), consumed, nil
+			}
+			if consumed == len(following) {
+				return "", 0, fmt.Errorf("unterminated double-quoted value")
+			}
+			text += "\n" + following[consumed]
+			consumed++
+		}
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated single-quoted value")
+		}
+		if err := checkDotenvTrailer(value[end+2:]); err != nil {
+			return "", 0, err
+		}
+		return value[1 : end+1], 0, nil
+	default:
+		for i := 1; i < len(value); i++ {
+			if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+				value = value[:i]
+				break
+			}
+		}
+		return strings.TrimSpace(value), 0, nil
+	}
+}
+
+// closingQuote returns the index of the first double quote in text that is not escaped
+func closingQuote(text string) int {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// checkDotenvTrailer allows only a comment after a quoted value
+func checkDotenvTrailer(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected text after quoted value: %q", rest)
+	}
+	return nil
+}
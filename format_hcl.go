@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+)
+
+// parseHCLFile parses an HCL file. Block labels become key segments, so service "web" { port = 80 }
+// defines service/web/port, and repeated blocks with the same labels are merged.
+func parseHCLFile(filePath string, data []byte, _ LoadOptions) (*SourceFile, error) {
+	file, err := hcl.ParseBytes(data)
+	if err != nil {
+		var posErr *parser.PosError
+		if errors.As(err, &posErr) {
+			err = fmt.Errorf("line %d: %w", posErr.Pos.Line, posErr.Err)
+		}
+		return nil, loadDiagnosticError(filePath, "parse HCL file", err)
+	}
+
+	builder := newSourceBuilder(filePath)
+	if list, ok := file.Node.(*ast.ObjectList); ok {
+		if err := builder.addHCLItems(list, nil); err != nil {
+			return nil, loadDiagnosticError(filePath, "load", err)
+		}
+	}
+
+	return builder.source, nil
+}
+
+func (b *sourceBuilder) addHCLItems(list *ast.ObjectList, path []string) error {
+	for _, item := range list.Items {
+		itemPath := append([]string(nil), path...)
+		for _, key := range item.Keys {
+			itemPath = append(itemPath, fmt.Sprint(key.Token.Value()))
+		}
+		line := item.Pos().Line
+
+		if object, ok := item.Val.(*ast.ObjectType); ok {
+			if _, err := b.object(itemPath, line); err != nil {
+				return err
+			}
+			if err := b.addHCLItems(object.List, itemPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := b.set(itemPath, hclValue(item.Val), line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hclValue converts a value that is not addressed by key paths, i.e. a literal or a list
+func hclValue(node ast.Node) interface{} {
+	switch v := node.(type) {
+	case *ast.LiteralType:
+		return v.Token.Value()
+	case *ast.ListType:
+		list := make([]interface{}, len(v.List))
+		for i, item := range v.List {
+			list[i] = hclValue(item)
+		}
+		return list
+	case *ast.ObjectType:
+		object := make(map[string]interface{})
+		for _, item := range v.List.Items {
+			target := object
+			for i, key := range item.Keys {
+				name := fmt.Sprint(key.Token.Value())
+				if i == len(item.Keys)-1 {
+					target[name] = hclValue(item.Val)
+					break
+				}
+				child, ok := target[name].(map[string]interface{})
+				if !ok {
+					child = make(map[string]interface{})
+					target[name] = child
+				}
+				target = child
+			}
+		}
+		return object
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// parseJSONFile parses a JSON file whose top level is an object. Numbers keep the text they are written with.
+func parseJSONFile(filePath string, data []byte, _ LoadOptions) (*SourceFile, error) {
+	builder := newSourceBuilder(filePath)
+	if err := builder.parseJSON(data); err != nil {
+		return nil, loadDiagnosticError(filePath, "parse JSON file", err)
+	}
+	return builder.source, nil
+}
+
+func (b *sourceBuilder) parseJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return jsonSyntaxError(data, decoder, err)
+	}
+	if token != json.Delim('{') {
+		return fmt.Errorf("line %d: top-level value must be an object", lineAt(data, int(decoder.InputOffset())))
+	}
+
+	if err := b.parseJSONObject(data, decoder, nil); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("line %d: unexpected data after the top-level object", lineAt(data, int(decoder.InputOffset())))
+	}
+	return nil
+}
+
+// parseJSONObject reads the members of an object after its opening brace, including the closing brace
+func (b *sourceBuilder) parseJSONObject(data []byte, decoder *json.Decoder, path []string) error {
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return jsonSyntaxError(data, decoder, err)
+		}
+		key := token.(string)
+		line := lineAt(data, int(decoder.InputOffset()))
+		keyPath := append(append([]string(nil), path...), key)
+
+		token, err = decoder.Token()
+		if err != nil {
+			return jsonSyntaxError(data, decoder, err)
+		}
+
+		if token == json.Delim('{') {
+			if _, err := b.object(keyPath, line); err != nil {
+				return err
+			}
+			if err := b.parseJSONObject(data, decoder, keyPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := readJSONValue(data, decoder, token)
+		if err != nil {
+			return err
+		}
+		if err := b.set(keyPath, value, line); err != nil {
+			return err
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return jsonSyntaxError(data, decoder, err)
+	}
+	return nil
+}
+
+// readJSONValue reads the value starting with token
+func readJSONValue(data []byte, decoder *json.Decoder, token json.Token) (interface{}, error) {
+	switch token {
+	case json.Delim('['):
+		list := []interface{}{}
+		for decoder.More() {
+			item, err := readNextJSONValue(data, decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		_, err := decoder.Token()
+		return list, jsonSyntaxError(data, decoder, err)
+	case json.Delim('{'):
+		object := map[string]interface{}{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, jsonSyntaxError(data, decoder, err)
+			}
+			value, err := readNextJSONValue(data, decoder)
+			if err != nil {
+				return nil, err
+			}
+			object[key.(string)] = value
+		}
+		_, err := decoder.Token()
+		return object, jsonSyntaxError(data, decoder, err)
+	default:
+		return token, nil
+	}
+}
+
+func readNextJSONValue(data []byte, decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, jsonSyntaxError(data, decoder, err)
+	}
+	return readJSONValue(data, decoder, token)
+}
+
+// jsonSyntaxError adds the line the decoder stopped at to err
+func jsonSyntaxError(data []byte, decoder *json.Decoder, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	offset := decoder.InputOffset()
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	}
+	return fmt.Errorf("line %d: %w", lineAt(data, int(offset)), err)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parsePropertiesFile parses a Java .properties file. Dots in keys separate key segments,
+// so database.host defines database/host.
+func parsePropertiesFile(filePath string, data []byte, _ LoadOptions) (*SourceFile, error) {
+	builder := newSourceBuilder(filePath)
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		// A line ending in an odd number of backslashes continues on the next line
+		for endsWithContinuation(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		if endsWithContinuation(line) {
+			line = line[:len(line)-1]
+		}
+
+		rawKey, rawValue := splitProperty(line)
+		key, err := unescapeProperty(rawKey)
+		if err == nil && key == "" {
+			err = fmt.Errorf("empty key")
+		}
+		if err != nil {
+			return nil, loadDiagnosticError(filePath, "parse .properties file", fmt.Errorf("line %d: %w", lineNumber, err))
+		}
+		value, err := unescapeProperty(rawValue)
+		if err != nil {
+			return nil, loadDiagnosticError(filePath, "parse .properties file", fmt.Errorf("line %d: %s: %w", lineNumber, key, err))
+		}
+
+		if err := builder.set(strings.Split(key, "."), value, lineNumber); err != nil {
+			return nil, loadDiagnosticError(filePath, "load", err)
+		}
+	}
+
+	return builder.source, nil
+}
+
+func endsWithContinuation(line string) bool {
+	backslashes := len(line) - len(strings.TrimRight(line, `\`))
+	return backslashes%2 == 1
+}
+
+// splitProperty splits a logical line at the first unescaped '=', ':' or whitespace. Whitespace
+// around the separator is not part of the key or the value.
+func splitProperty(line string) (string, string) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+
+	key, rest := line[:end], strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return key, rest
+}
+
+// unescapeProperty resolves the backslash escapes of a key or value, including \uXXXX
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("malformed \\u escape")
+			}
+			code, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\u escape: \\u%s", s[i+1:i+5])
+			}
+			sb.WriteRune(rune(code))
+			i += 4
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+
+	return sb.String(), nil
+}
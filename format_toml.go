@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// parseTOMLFile parses a TOML file. Tables become nested keys, and offset date-times are written in RFC 3339.
+func parseTOMLFile(filePath string, data []byte, _ LoadOptions) (*SourceFile, error) {
+	var content map[string]interface{}
+	if err := toml.Unmarshal(data, &content); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			row, _ := decodeErr.Position()
+			err = fmt.Errorf("line %d: %w", row, err)
+		}
+		return nil, loadDiagnosticError(filePath, "parse TOML file", err)
+	}
+	if content == nil {
+		content = make(map[string]interface{})
+	}
+	normalizeTOMLValues(content)
+
+	return &SourceFile{
+		Path:    filePath,
+		Content: content,
+		Keys:    tomlKeyLines(filePath, data),
+	}, nil
+}
+
+// normalizeTOMLValues replaces date-times with their RFC 3339 form
+func normalizeTOMLValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeTOMLValues(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeTOMLValues(item)
+		}
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// tomlKeyLines records the line of every key path of a TOML document. Keys inside arrays
+// of tables are not addressable and only the array itself is recorded.
+func tomlKeyLines(filePath string, data []byte) map[string]KeyInfo {
+	keys := make(map[string]KeyInfo)
+	record := func(path []string, line int) {
+		for i := range path {
+			key := strings.Join(path[:i+1], "/")
+			if _, exists := keys[key]; !exists {
+				keys[key] = KeyInfo{File: filePath, Line: line}
+			}
+		}
+	}
+
+	var parser unstable.Parser
+	parser.Reset(data)
+
+	var table []string
+	inArray := false
+	for parser.NextExpression() {
+		expression := parser.Expression()
+		switch expression.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			path, line := tomlKey(data, expression.Key())
+			table = path
+			inArray = expression.Kind == unstable.ArrayTable
+			record(table, line)
+		case unstable.KeyValue:
+			if !inArray {
+				recordTOMLKeyValue(data, expression, table, record)
+			}
+		}
+	}
+
+	return keys
+}
+
+func recordTOMLKeyValue(data []byte, node *unstable.Node, table []string, record func([]string, int)) {
+	path, line := tomlKey(data, node.Key())
+	path = append(append([]string(nil), table...), path...)
+	record(path, line)
+
+	if value := node.Value(); value.Kind == unstable.InlineTable {
+		children := value.Children()
+		for children.Next() {
+			recordTOMLKeyValue(data, children.Node(), path, record)
+		}
+	}
+}
+
+// tomlKey returns the parts of a dotted key and the line it starts on
+func tomlKey(data []byte, key unstable.Iterator) ([]string, int) {
+	var parts []string
+	line := 0
+	for key.Next() {
+		part := key.Node()
+		if line == 0 {
+			line = lineAt(data, int(part.Raw.Offset))
+		}
+		parts = append(parts, string(part.Data))
+	}
+	return parts, line
+}
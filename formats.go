@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Input formats of the files listed for an environment
+const (
+	FormatYAML       = "yaml"
+	FormatJSON       = "json"
+	FormatTOML       = "toml"
+	FormatHCL        = "hcl"
+	FormatDotenv     = "dotenv"
+	FormatProperties = "properties"
+)
+
+// FormatLoader parses the data of a file into its content and the line of every key
+type FormatLoader func(filePath string, data []byte, opts LoadOptions) (*SourceFile, error)
+
+// formatLoaders maps every supported input format to its loader
+var formatLoaders = map[string]FormatLoader{
+	FormatYAML:       parseYAMLFile,
+	FormatJSON:       parseJSONFile,
+	FormatTOML:       parseTOMLFile,
+	FormatHCL:        parseHCLFile,
+	FormatDotenv:     parseDotenvFile,
+	FormatProperties: parsePropertiesFile,
+}
+
+// formatExtensions maps file extensions to the format they are loaded as
+var formatExtensions = map[string]string{
+	".yaml":       FormatYAML,
+	".yml":        FormatYAML,
+	".json":       FormatJSON,
+	".toml":       FormatTOML,
+	".hcl":        FormatHCL,
+	".env":        FormatDotenv,
+	".properties": FormatProperties,
+}
+
+// detectFormat returns the format of a file: the one set for its entry, or else the one of its
+// extension. Templates are detected by the extension before .tmpl, and files with an unknown
+// extension are loaded as YAML.
+func detectFormat(filePath, format string) string {
+	if format != "" {
+		return format
+	}
+
+	name := strings.TrimSuffix(filepath.Base(filePath), TemplateExtension)
+	if format, ok := formatExtensions[strings.ToLower(filepath.Ext(name))]; ok {
+		return format
+	}
+	// .env files are usually named just ".env"
+	if name == ".env" || strings.HasPrefix(name, ".env.") {
+		return FormatDotenv
+	}
+
+	return FormatYAML
+}
+
+// supportedFormats returns the names of all formats, for error messages
+func supportedFormats() []string {
+	formats := make([]string, 0, len(formatLoaders))
+	for format := range formatLoaders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// sourceBuilder assembles the nested content of a file in a format other than YAML
+// from the key paths its loader reports
+type sourceBuilder struct {
+	source *SourceFile
+}
+
+func newSourceBuilder(filePath string) *sourceBuilder {
+	return &sourceBuilder{source: &SourceFile{
+		Path:    filePath,
+		Content: make(map[string]interface{}),
+		Keys:    make(map[string]KeyInfo),
+	}}
+}
+
+// set stores the value of a key path defined at line. A key that is already defined,
+// or that is a parent of or below a plain value, is reported as a conflict.
+func (b *sourceBuilder) set(path []string, value interface{}, line int) error {
+	parent, err := b.parent(path, line)
+	if err != nil {
+		return err
+	}
+
+	key := strings.Join(path, "/")
+	if _, exists := parent[path[len(path)-1]]; exists {
+		return b.conflictError(key, line)
+	}
+
+	parent[path[len(path)-1]] = value
+	b.source.Keys[key] = KeyInfo{File: b.source.Path, Line: line}
+	return nil
+}
+
+// object returns the map of a key path defined at line, creating it when needed.
+// Unlike set it accepts a key that is already an object, so repeated tables and blocks are merged.
+func (b *sourceBuilder) object(path []string, line int) (map[string]interface{}, error) {
+	parent, err := b.parent(path, line)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.Join(path, "/")
+	name := path[len(path)-1]
+	existing, exists := parent[name]
+	if !exists {
+		child := make(map[string]interface{})
+		parent[name] = child
+		b.source.Keys[key] = KeyInfo{File: b.source.Path, Line: line}
+		return child, nil
+	}
+
+	child, ok := existing.(map[string]interface{})
+	if !ok {
+		return nil, b.conflictError(key, line)
+	}
+	return child, nil
+}
+
+// parent returns the map that holds the last segment of path
+func (b *sourceBuilder) parent(path []string, line int) (map[string]interface{}, error) {
+	current := b.source.Content
+	for i, segment := range path[:len(path)-1] {
+		existing, exists := current[segment]
+		if !exists {
+			child := make(map[string]interface{})
+			current[segment] = child
+			current = child
+			continue
+		}
+
+		child, ok := existing.(map[string]interface{})
+		if !ok {
+			return nil, b.conflictError(strings.Join(path[:i+1], "/"), line)
+		}
+		current = child
+	}
+	return current, nil
+}
+
+func (b *sourceBuilder) conflictError(key string, line int) error {
+	return fmt.Errorf("line %d: key '%s' is already defined at line %d", line, key, keyLine(b.source.Keys, key))
+}
+
+// lineAt returns the line of a byte offset in data
+func lineAt(data []byte, offset int) int {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadSourceFileFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		format   string
+		content  string
+		expected map[string]KVPair
+	}{
+		{
+			name: "json",
+			file: "app.json",
+			content: `{
+  "app": {
+    "name": "myapp",
+    "port": 8080,
+    "ratio": 0.25,
+    "debug": false,
+    "hosts": ["a", "b"]
+  },
+  "empty": {}
+}
+`,
+			expected: map[string]KVPair{
+				"app/name":  {Value: "myapp", Line: 3},
+				"app/port":  {Value: "8080", Line: 4},
+				"app/ratio": {Value: "0.25", Line: 5},
+				"app/debug": {Value: "false", Line: 6},
+				"app/hosts": {Value: "[a b]", Line: 7},
+			},
+		},
+		{
+			name: "toml",
+			file: "app.toml",
+			content: `title = "myapp"
+
+[database]
+host = "db.local"
+port = 5432
+pool.size = 10
+options = { timeout = 30 }
+
+[[workers]]
+name = "a"
+
+[release]
+date = 2024-01-02T03:04:05Z
+`,
+			expected: map[string]KVPair{
+				"title":                    {Value: "myapp", Line: 1},
+				"database/host":            {Value: "db.local", Line: 4},
+				"database/port":            {Value: "5432", Line: 5},
+				"database/pool/size":       {Value: "10", Line: 6},
+				"database/options/timeout": {Value: "30", Line: 7},
+				"workers":                  {Value: "[map[name:a]]", Line: 9},
+				"release/date":             {Value: "2024-01-02T03:04:05Z", Line: 13},
+			},
+		},
+		{
+			name: "hcl",
+			file: "app.hcl",
+			content: `name = "myapp"
+
+service "web" {
+  port = 80
+  tags = ["a", "b"]
+}
+
+service "web" {
+  replicas = 2
+}
+`,
+			expected: map[string]KVPair{
+				"name":                 {Value: "myapp", Line: 1},
+				"service/web/port":     {Value: "80", Line: 4},
+				"service/web/tags":     {Value: "[a b]", Line: 5},
+				"service/web/replicas": {Value: "2", Line: 9},
+			},
+		},
+		{
+			name: "dotenv",
+			file: ".env",
+			content: `# comment
+APP_NAME=myapp
+export PORT = 8080
+GREETING="hello\nworld" # trailing comment
+LITERAL='$HOME\n'
+MULTILINE="line one
+line two"
+EMPTY=
+URL=http://example.com/#anchor # comment
+`,
+			expected: map[string]KVPair{
+				"APP_NAME":  {Value: "myapp", Line: 2},
+				"PORT":      {Value: "8080", Line: 3},
+				"GREETING":  {Value: "hello\nworld", Line: 4},
+				"LITERAL":   {Value: `$HOME\n`, Line: 5},
+				"MULTILINE": {Value: "line one\nline two", Line: 6},
+				"EMPTY":     {Value: "", Line: 8},
+				"URL":       {Value: "http://example.com/#anchor", Line: 9},
+			},
+		},
+		{
+			name: "properties",
+			file: "app.properties",
+			content: `# comment
+! another comment
+app.name = myapp
+app.port:8080
+app.greeting hello world
+app.list = a, \
+           b, \
+           c
+app.unicode = caf\u00e9
+app.path = C:\\temp
+app.key\ with\ spaces = x
+`,
+			expected: map[string]KVPair{
+				"app/name":            {Value: "myapp", Line: 3},
+				"app/port":            {Value: "8080", Line: 4},
+				"app/greeting":        {Value: "hello world", Line: 5},
+				"app/list":            {Value: "a, b, c", Line: 6},
+				"app/unicode":         {Value: "café", Line: 9},
+				"app/path":            {Value: `C:\temp`, Line: 10},
+				"app/key with spaces": {Value: "x", Line: 11},
+			},
+		},
+		{
+			name:    "format override",
+			file:    "app.conf",
+			format:  FormatProperties,
+			content: "app.name=myapp\n",
+			expected: map[string]KVPair{
+				"app/name": {Value: "myapp", Line: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			source, err := loadSourceFile(path, LoadOptions{Format: tt.format})
+			if err != nil {
+				t.Fatalf("loadSourceFile() error = %v", err)
+			}
+
+			pairs := collectAllKVPairs([]*SourceFile{source})
+			if len(pairs) != len(tt.expected) {
+				t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(tt.expected), pairs)
+			}
+			for _, pair := range pairs {
+				want, ok := tt.expected[pair.Key]
+				if !ok {
+					t.Errorf("unexpected key %s", pair.Key)
+					continue
+				}
+				if pair.Value != want.Value || pair.Line != want.Line || pair.File != path {
+					t.Errorf("%s = %q at %s:%d, want %q at line %d", pair.Key, pair.Value, pair.File, pair.Line, want.Value, want.Line)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSourceFileFormatErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		wantErr  string
+		wantLine int
+	}{
+		{
+			name:     "json syntax error",
+			file:     "app.json",
+			content:  "{\n  \"a\": 1,\n  \"b\": \n}\n",
+			wantErr:  "failed to parse JSON file",
+			wantLine: 4,
+		},
+		{
+			name:     "json top level array",
+			file:     "app.json",
+			content:  "[1, 2]\n",
+			wantErr:  "top-level value must be an object",
+			wantLine: 1,
+		},
+		{
+			name:     "json duplicate key",
+			file:     "app.json",
+			content:  "{\n  \"a\": 1,\n  \"a\": 2\n}\n",
+			wantErr:  "key 'a' is already defined at line 2",
+			wantLine: 3,
+		},
+		{
+			name:     "toml syntax error",
+			file:     "app.toml",
+			content:  "a = 1\nb = \n",
+			wantErr:  "failed to parse TOML file",
+			wantLine: 2,
+		},
+		{
+			name:     "hcl conflicting values",
+			file:     "app.hcl",
+			content:  "db {\n  host = \"a\"\n}\n\ndb {\n  host = \"b\"\n}\n",
+			wantErr:  "key 'db/host' is already defined at line 2",
+			wantLine: 6,
+		},
+		{
+			name:     "dotenv missing equals sign",
+			file:     "app.env",
+			content:  "A=1\nB\n",
+			wantErr:  "expected KEY=VALUE",
+			wantLine: 2,
+		},
+		{
+			name:     "dotenv unterminated quote",
+			file:     "app.env",
+			content:  "A=\"open\nB=2\n",
+			wantErr:  "unterminated double-quoted value",
+			wantLine: 1,
+		},
+		{
+			name:     "properties key below a value",
+			file:     "app.properties",
+			content:  "app=1\n\napp.name=x\n",
+			wantErr:  "key 'app' is already defined at line 1",
+			wantLine: 3,
+		},
+		{
+			name:     "properties malformed unicode escape",
+			file:     "app.properties",
+			content:  "a=\\u12\n",
+			wantErr:  "malformed \\u escape",
+			wantLine: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := loadSourceFile(path, LoadOptions{})
+			var diagErr *DiagnosticError
+			if !errors.As(err, &diagErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadSourceFile() error = %v, want %q", err, tt.wantErr)
+			}
+			if line := diagErr.Diagnostics[0].Line; line != tt.wantLine {
+				t.Errorf("diagnostic line = %d, want %d", line, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		path     string
+		format   string
+		expected string
+	}{
+		{"app.yaml", "", FormatYAML},
+		{"app.yml", "", FormatYAML},
+		{"app.JSON", "", FormatJSON},
+		{"app.toml", "", FormatTOML},
+		{"app.hcl", "", FormatHCL},
+		{"app.env", "", FormatDotenv},
+		{".env", "", FormatDotenv},
+		{".env.production", "", FormatDotenv},
+		{"app.properties", "", FormatProperties},
+		{"app.json.tmpl", "", FormatJSON},
+		{"app.yaml.tmpl", "", FormatYAML},
+		{"app.conf", "", FormatYAML},
+		{"app.yaml", FormatJSON, FormatJSON},
+	}
+
+	for _, tt := range tests {
+		if got := detectFormat(tt.path, tt.format); got != tt.expected {
+			t.Errorf("detectFormat(%q, %q) = %q, want %q", tt.path, tt.format, got, tt.expected)
+		}
+	}
+}
+
+func TestFileEntryUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []FileEntry
+		wantErr  string
+	}{
+		{
+			name:     "plain paths and mappings",
+			content:  "files:\n  - app.yaml\n  - path: app.conf\n    format: properties\n",
+			expected: []FileEntry{{Path: "app.yaml"}, {Path: "app.conf", Format: FormatProperties}},
+		},
+		{
+			name:    "unknown format",
+			content: "files:\n  - path: app.conf\n    format: ini\n",
+			wantErr: "line 2: unknown format 'ini'",
+		},
+		{
+			name:    "missing path",
+			content: "files:\n  - format: json\n",
+			wantErr: "line 2: file entry has no path",
+		},
+		{
+			name:    "unknown setting",
+			content: "files:\n  - path: app.json\n    type: json\n",
+			wantErr: "line 3: unknown setting 'type'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var env Environment
+			err := yaml.Unmarshal([]byte(tt.content), &env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Unmarshal() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if len(env.Files) != len(tt.expected) {
+				t.Fatalf("Files = %+v, want %+v", env.Files, tt.expected)
+			}
+			for i := range tt.expected {
+				if env.Files[i] != tt.expected[i] {
+					t.Errorf("Files[%d] = %+v, want %+v", i, env.Files[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDetectDuplicatesAcrossFormats(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"app.yaml":       "app:\n  name: a\n",
+		"app.properties": "# comment\napp.name=b\n",
+	})
+
+	sources, err := loadAllSourceFiles([]FileEntry{
+		{Path: filepath.Join(dir, "app.yaml")},
+		{Path: filepath.Join(dir, "app.properties")},
+	}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadAllSourceFiles() error = %v", err)
+	}
+
+	duplicates := detectSourceDuplicates(sources)
+	if len(duplicates) != 1 || duplicates[0].Key != "app/name" {
+		t.Fatalf("duplicates = %+v, want app/name", duplicates)
+	}
+	if line := duplicates[0].Files[1].Line; line != 2 {
+		t.Errorf("line in app.properties = %d, want 2", line)
+	}
+}
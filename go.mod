@@ -2,4 +2,15 @@ module github.com/zinrai/consul-kv-sync
 
 go 1.24.0
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	filippo.io/age v1.2.1
+	github.com/hashicorp/hcl v1.0.0
+	github.com/pelletier/go-toml/v2 v2.2.4
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// StdinPath is the import path that reads from standard input
+const StdinPath = "-"
+
+// readImportFile reads KV pairs in Consul JSON export format from a file, or from stdin when path is "-"
+func readImportFile(path string) ([]KVPair, error) {
+	if path == StdinPath {
+		return decodeExport(os.Stdin, "stdin")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	return decodeExport(file, path)
+}
+
+// displayImportPath returns a human readable name for an import path
+func displayImportPath(path string) string {
+	if path == StdinPath {
+		return "stdin"
+	}
+	return path
+}
+
+// decodeExport decodes and validates the [{key, flags, value}] format produced by
+// -export and `consul kv export`
+func decodeExport(r io.Reader, source string) ([]KVPair, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var entries []ExportedKV
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON from %s: %w", source, err)
+	}
+
+	pairs := make([]KVPair, len(entries))
+	var problems []string
+	seen := make(map[string]int)
+
+	for i, entry := range entries {
+		if entry.Key == "" {
+			problems = append(problems, fmt.Sprintf("entry %d: key is empty", i))
+			continue
+		}
+
+		if first, exists := seen[entry.Key]; exists {
+			problems = append(problems, fmt.Sprintf("entry %d: key '%s' already defined by entry %d", i, entry.Key, first))
+			continue
+		}
+		seen[entry.Key] = i
+
+		value, err := base64.StdEncoding.DecodeString(entry.Value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("entry %d: failed to decode value of key '%s': %v", i, entry.Key, err))
+			continue
+		}
+
+		pairs[i] = KVPair{Key: entry.Key, Value: string(value), Flags: entry.Flags, File: source}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid entries in %s:\n  %s", source, strings.Join(problems, "\n  "))
+	}
+
+	return pairs, nil
+}
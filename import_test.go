@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeExport(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  []KVPair
+		wantError string
+	}{
+		{
+			name:  "tool export format",
+			input: `[{"key": "app/name", "value": "bXlhcHA="}]`,
+			expected: []KVPair{
+				{Key: "app/name", Value: "myapp", File: "test.json"},
+			},
+		},
+		{
+			name: "consul kv export format with flags",
+			input: `[
+				{"key": "app/name", "flags": 0, "value": "bXlhcHA="},
+				{"key": "app/config", "flags": 42, "value": "e30="}
+			]`,
+			expected: []KVPair{
+				{Key: "app/name", Value: "myapp", File: "test.json"},
+				{Key: "app/config", Value: "{}", Flags: 42, File: "test.json"},
+			},
+		},
+		{
+			name:     "empty export",
+			input:    `[]`,
+			expected: []KVPair{},
+		},
+		{
+			name:      "invalid base64",
+			input:     `[{"key": "app/name", "value": "not base64!"}]`,
+			wantError: "failed to decode value of key 'app/name'",
+		},
+		{
+			name:      "empty key",
+			input:     `[{"key": "", "value": ""}]`,
+			wantError: "entry 0: key is empty",
+		},
+		{
+			name:      "duplicate key",
+			input:     `[{"key": "a", "value": ""}, {"key": "a", "value": ""}]`,
+			wantError: "entry 1: key 'a' already defined by entry 0",
+		},
+		{
+			name:      "unknown field",
+			input:     `[{"key": "a", "value": "", "session": "x"}]`,
+			wantError: "unknown field",
+		},
+		{
+			name:      "not an array",
+			input:     `{"key": "a"}`,
+			wantError: "failed to parse JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := decodeExport(strings.NewReader(tt.input), "test.json")
+
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("decodeExport() error = %v, want error containing %q", err, tt.wantError)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("decodeExport() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("decodeExport() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunImportChecksPairs(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxSize   int
+		wantError []string
+	}{
+		{
+			name:      "malformed keys",
+			input:     `[{"key": "a//b", "value": ""}, {"key": "/lead", "value": ""}, {"key": "ok", "value": ""}]`,
+			wantError: []string{"2 invalid keys:", `"a//b": key contains an empty segment`, `"/lead": key starts with '/'`},
+		},
+		{
+			name:      "value too large",
+			input:     `[{"key": "app/blob", "value": "MTIzNDU2"}]`,
+			maxSize:   4,
+			wantError: []string{"app/blob: value is 6 bytes, more than the limit of 4 bytes"},
+		},
+		{
+			name:    "valid pairs",
+			input:   `[{"key": "app/name", "value": "bXlhcHA="}]`,
+			maxSize: 512,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "export.json")
+			if err := os.WriteFile(path, []byte(tt.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := Options{Import: path, DryRun: true, MaxSize: tt.maxSize}
+			err := runImport(context.Background(), opts, path, &RunReport{})
+			if len(tt.wantError) == 0 {
+				if err != nil {
+					t.Fatalf("runImport() error = %v", err)
+				}
+				return
+			}
+
+			var diagErr *DiagnosticError
+			if !errors.As(err, &diagErr) {
+				t.Fatalf("runImport() error = %v, want DiagnosticError", err)
+			}
+			for _, want := range tt.wantError {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("runImport() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunImportSortsPairs(t *testing.T) {
+	fake, server := newFakeConsul(t, nil)
+
+	path := filepath.Join(t.TempDir(), "export.json")
+	input := `[{"key": "b/x", "value": ""}, {"key": "a/y", "value": ""}, {"key": "a/x", "value": ""}]`
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Import: path, ConsulAddr: server.URL, Datacenter: DefaultDatacenter, Output: OutputJSON}
+	report := &RunReport{}
+	if err := runImport(context.Background(), opts, path, report); err != nil {
+		t.Fatalf("runImport() error = %v", err)
+	}
+	if len(fake.data) != 3 {
+		t.Errorf("consul has %d keys, want 3", len(fake.data))
+	}
+
+	var keys []string
+	for _, result := range report.Summary.Results {
+		for _, pair := range result.Pairs {
+			keys = append(keys, pair.Key)
+		}
+	}
+	if expected := []string{"a/x", "a/y", "b/x"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("batched keys = %v, want %v", keys, expected)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IncludeTag replaces a value with the content of another YAML file
+const IncludeTag = "!include"
+
+// includeResolver replaces !include nodes with the documents they reference
+type includeResolver struct {
+	stack    []string              // files currently being resolved, outermost first
+	included map[*yaml.Node]string // replaced nodes and the file their content came from
+}
+
+func newIncludeResolver(filePath string) *includeResolver {
+	return &includeResolver{
+		stack:    []string{includeKey(filePath)},
+		included: make(map[*yaml.Node]string),
+	}
+}
+
+// resolve replaces every !include below node. Paths are relative to filePath, the file containing node.
+func (r *includeResolver) resolve(node *yaml.Node, filePath string) error {
+	if node.Tag != IncludeTag {
+		for _, child := range node.Content {
+			if err := r.resolve(child, filePath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if node.Kind != yaml.ScalarNode || node.Value == "" {
+		return fmt.Errorf("line %d: %s expects a file path", node.Line, IncludeTag)
+	}
+
+	path := node.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(filePath), path)
+	}
+
+	root, err := r.load(path)
+	if err != nil {
+		return fmt.Errorf("line %d: failed to include %s: %w", node.Line, node.Value, err)
+	}
+
+	*node = *root
+	r.included[node] = path
+	return nil
+}
+
+// load parses, decrypts and resolves the includes of an included file
+func (r *includeResolver) load(path string) (*yaml.Node, error) {
+	key := includeKey(path)
+	for i, parent := range r.stack {
+		if parent == key {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(r.stack[i:], key), " -> "))
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := decodeDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Line: 1, Column: 1}, nil
+	}
+	if len(documents) > 1 {
+		return nil, fmt.Errorf("included files must contain a single YAML document, found %d", len(documents))
+	}
+
+	root := documents[0].Content[0]
+	if err := decryptDocuments([]*yaml.Node{root}); err != nil {
+		return nil, err
+	}
+
+	r.stack = append(r.stack, key)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	if err := r.resolve(root, path); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// includeKey identifies a file for cycle detection
+func includeKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the given files below dir and returns dir
+func writeFiles(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// fileEntries returns an entry in the format of its extension for every path
+func fileEntries(paths ...string) []FileEntry {
+	entries := make([]FileEntry, len(paths))
+	for i, path := range paths {
+		entries[i] = FileEntry{Path: path}
+	}
+	return entries
+}
+
+func TestLoadYAMLFileInclude(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"app.yaml": `app:
+  <<: !include shared/defaults.yaml
+  retries: 5
+  database: !include shared/database.yaml
+`,
+		"shared/defaults.yaml": `timeout: 30s
+retries: 3
+`,
+		"shared/database.yaml": `host: db.internal
+pool: !include pool.yaml
+`,
+		"shared/pool.yaml": `min: 1
+max: 10
+`,
+	})
+
+	source, err := loadSourceFile(filepath.Join(dir, "app.yaml"), LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	expected := map[string]struct {
+		value string
+		file  string
+		line  int
+	}{
+		"app/timeout":           {"30s", "shared/defaults.yaml", 1},
+		"app/retries":           {"5", "app.yaml", 3},
+		"app/database/host":     {"db.internal", "shared/database.yaml", 1},
+		"app/database/pool/min": {"1", "shared/pool.yaml", 1},
+		"app/database/pool/max": {"10", "shared/pool.yaml", 2},
+	}
+
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	if len(pairs) != len(expected) {
+		t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(expected), pairs)
+	}
+	for _, pair := range pairs {
+		want := expected[pair.Key]
+		if pair.Value != want.value || pair.File != filepath.Join(dir, want.file) || pair.Line != want.line {
+			t.Errorf("%s = %q at %s:%d, want %q at %s:%d",
+				pair.Key, pair.Value, pair.File, pair.Line, want.value, want.file, want.line)
+		}
+	}
+}
+
+func TestLoadYAMLFileIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"app.yaml": "app: !include a.yaml\n",
+				"a.yaml":   "b: !include b.yaml\n",
+				"b.yaml":   "a: !include a.yaml\n",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name: "self include",
+			files: map[string]string{
+				"app.yaml": "app: !include app.yaml\n",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"app.yaml": "app:\n  x: !include missing.yaml\n",
+			},
+			wantErr: "line 2: failed to include missing.yaml",
+		},
+		{
+			name: "not a path",
+			files: map[string]string{
+				"app.yaml": "app: !include [a.yaml]\n",
+			},
+			wantErr: "expects a file path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, t.TempDir(), tt.files)
+
+			_, err := loadSourceFile(filepath.Join(dir, "app.yaml"), LoadOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadSourceFile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDetectDuplicatesInIncludedFiles(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"app.yaml":    "app: !include shared.yaml\n",
+		"shared.yaml": "name: myapp\nport: 8080\n",
+		"other.yaml":  "# other\napp:\n  port: 9090\n",
+	})
+
+	sources, err := loadAllSourceFiles(fileEntries(filepath.Join(dir, "app.yaml"), filepath.Join(dir, "other.yaml")), LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadAllSourceFiles() error = %v", err)
+	}
+
+	duplicates := detectSourceDuplicates(sources)
+	if len(duplicates) != 1 || duplicates[0].Key != "app/port" {
+		t.Fatalf("duplicates = %+v, want app/port", duplicates)
+	}
+
+	locations := make([]string, len(duplicates[0].Files))
+	for i, file := range duplicates[0].Files {
+		locations[i] = formatLocation(file.Filename, file.Line)
+	}
+	want := []string{filepath.Join(dir, "shared.yaml") + ":2", filepath.Join(dir, "other.yaml") + ":3"}
+	if strings.Join(locations, ",") != strings.Join(want, ",") {
+		t.Errorf("duplicate locations = %v, want %v", locations, want)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// InterpolationFilePrefix introduces a reference to the contents of a file
+	InterpolationFilePrefix = "file:"
+
+	// InterpolationDefaultSeparator separates a variable name from its default value
+	InterpolationDefaultSeparator = ":-"
+)
+
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolatePairs resolves ${VAR}, ${VAR:-default} and ${file:path} references in the values of pairs.
+// The original value of every changed pair is kept in Template. Undefined variables resolve to an
+// empty string, or are reported as errors in strict mode. Values read verbatim from a file are left as they are.
+func interpolatePairs(pairs []KVPair, strict bool) error {
+	var diagnostics []Diagnostic
+
+	for i := range pairs {
+		pair := &pairs[i]
+		if pair.ValueFile != "" {
+			continue
+		}
+
+		value, problems, undefined := interpolateValue(pair.Value, filepath.Dir(pair.File))
+		for _, name := range undefined {
+			if strict {
+				problems = append(problems, fmt.Sprintf("variable %s is not set", name))
+				continue
+			}
+			slog.Warn("undefined variable replaced with an empty string", "key", pair.Key, "variable", name)
+		}
+
+		for _, problem := range problems {
+			diagnostics = append(diagnostics, Diagnostic{
+				Category: CategoryInterpolation,
+				File:     pair.File,
+				Line:     pair.Line,
+				Key:      pair.Key,
+				Message:  fmt.Sprintf("%s: %s", pair.Key, problem),
+			})
+		}
+
+		if value != pair.Value {
+			pair.Template = pair.Value
+			pair.Value = value
+		}
+	}
+
+	return diagnosticListError("failed to resolve %d references", diagnostics)
+}
+
+// interpolateValue resolves the references in a single value. File references are relative to baseDir.
+// It returns the resolved value, problems that make the value invalid, and the undefined variables.
+// "$${" is written as a literal "${".
+func interpolateValue(value, baseDir string) (string, []string, []string) {
+	var sb strings.Builder
+	var problems, undefined []string
+
+	for i := 0; i < len(value); {
+		if strings.HasPrefix(value[i:], "$${") {
+			sb.WriteString("${")
+			i += 3
+			continue
+		}
+
+		if !strings.HasPrefix(value[i:], "${") {
+			sb.WriteByte(value[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(value[i+2:], '}')
+		if end < 0 {
+			// The rest of the value may be a secret, so only its position is reported
+			problems = append(problems, fmt.Sprintf("unterminated reference at offset %d", i))
+			sb.WriteString(value[i:])
+			break
+		}
+
+		expr := value[i+2 : i+2+end]
+		i += end + 3
+
+		if path, ok := strings.CutPrefix(expr, InterpolationFilePrefix); ok {
+			content, err := readInterpolationFile(path, baseDir)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			sb.WriteString(content)
+			continue
+		}
+
+		name, fallback, hasDefault := strings.Cut(expr, InterpolationDefaultSeparator)
+		if !envVarName.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("invalid reference ${%s}", expr))
+			continue
+		}
+
+		resolved, ok := os.LookupEnv(name)
+		switch {
+		case ok && (resolved != "" || !hasDefault):
+			sb.WriteString(resolved)
+		case hasDefault:
+			sb.WriteString(fallback)
+		default:
+			undefined = append(undefined, name)
+		}
+	}
+
+	return sb.String(), problems, undefined
+}
+
+// hasReference reports whether value contains a reference that interpolation would resolve
+func hasReference(value string) bool {
+	return strings.Contains(strings.ReplaceAll(value, "$${", ""), "${")
+}
+
+// readInterpolationFile returns the contents of a referenced file without its trailing newline
+func readInterpolationFile(path, baseDir string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("empty file reference")
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read referenced file: %w", err)
+	}
+
+	content := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(content, "\r"), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateValue(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "version.txt"), []byte("1.4.2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("IMAGE_TAG", "abc123")
+	t.Setenv("EMPTY_VAR", "")
+	t.Setenv("UNSET_VAR", "")
+	os.Unsetenv("UNSET_VAR")
+
+	tests := []struct {
+		name          string
+		value         string
+		expected      string
+		wantProblems  int
+		wantUndefined []string
+	}{
+		{name: "no references", value: "plain value", expected: "plain value"},
+		{name: "variable", value: "registry/app:${IMAGE_TAG}", expected: "registry/app:abc123"},
+		{name: "default for unset variable", value: "${UNSET_VAR:-fallback}", expected: "fallback"},
+		{name: "default for empty variable", value: "${EMPTY_VAR:-fallback}", expected: "fallback"},
+		{name: "empty variable without default", value: "[${EMPTY_VAR}]", expected: "[]"},
+		{name: "file relative to YAML file", value: "v${file:version.txt}", expected: "v1.4.2"},
+		{name: "escaped reference", value: "$${IMAGE_TAG} is ${IMAGE_TAG}", expected: "${IMAGE_TAG} is abc123"},
+		{name: "lone dollar", value: "cost: $5", expected: "cost: $5"},
+		{name: "undefined variable", value: "a${UNSET_VAR}b", expected: "ab", wantUndefined: []string{"UNSET_VAR"}},
+		{name: "missing file", value: "${file:missing.txt}", expected: "", wantProblems: 1},
+		{name: "invalid name", value: "${not-a-name}", expected: "", wantProblems: 1},
+		{name: "unterminated", value: "x${IMAGE_TAG", expected: "x${IMAGE_TAG", wantProblems: 1},
+		{name: "unterminated before a secret", value: "p${4ssw0rd", expected: "p${4ssw0rd", wantProblems: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, problems, undefined := interpolateValue(tt.value, dir)
+			if value != tt.expected {
+				t.Errorf("value = %q, want %q", value, tt.expected)
+			}
+			if len(problems) != tt.wantProblems {
+				t.Errorf("problems = %v, want %d", problems, tt.wantProblems)
+			}
+			for _, problem := range problems {
+				if strings.Contains(problem, "4ssw0rd") {
+					t.Errorf("problem %q quotes the value", problem)
+				}
+			}
+			if !reflect.DeepEqual(undefined, tt.wantUndefined) {
+				t.Errorf("undefined = %v, want %v", undefined, tt.wantUndefined)
+			}
+		})
+	}
+}
+
+func TestInterpolatePairs(t *testing.T) {
+	t.Setenv("IMAGE_TAG", "abc123")
+	t.Setenv("UNSET_VAR", "")
+	os.Unsetenv("UNSET_VAR")
+
+	newPairs := func() []KVPair {
+		return []KVPair{
+			{Key: "app/image", Value: "app:${IMAGE_TAG}", File: "app.yaml", Line: 2},
+			{Key: "app/region", Value: "${UNSET_VAR}", File: "app.yaml", Line: 3},
+			{Key: "app/name", Value: "myapp", File: "app.yaml", Line: 4},
+		}
+	}
+
+	pairs := newPairs()
+	if err := interpolatePairs(pairs, false); err != nil {
+		t.Fatalf("interpolatePairs() error = %v", err)
+	}
+	if pairs[0].Value != "app:abc123" || pairs[0].Template != "app:${IMAGE_TAG}" {
+		t.Errorf("app/image = (%q, template %q)", pairs[0].Value, pairs[0].Template)
+	}
+	if pairs[1].Value != "" {
+		t.Errorf("app/region = %q, want empty string", pairs[1].Value)
+	}
+	if pairs[2].Template != "" {
+		t.Errorf("app/name has template %q, want none", pairs[2].Template)
+	}
+
+	display := formatKVPairsForDisplay(pairs)
+	if !strings.Contains(display, "Value: app:abc123\nFrom:  app:${IMAGE_TAG}\n") {
+		t.Errorf("display does not show template and value:\n%s", display)
+	}
+
+	err := interpolatePairs(newPairs(), true)
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) {
+		t.Fatalf("interpolatePairs(strict) error = %v, want DiagnosticError", err)
+	}
+	if len(diagErr.Diagnostics) != 1 || diagErr.Diagnostics[0].Key != "app/region" || diagErr.Diagnostics[0].Line != 3 {
+		t.Errorf("diagnostics = %+v, want one for app/region at line 3", diagErr.Diagnostics)
+	}
+	if !strings.Contains(err.Error(), "app.yaml:3: app/region: variable UNSET_VAR is not set") {
+		t.Errorf("error = %q", err)
+	}
+}
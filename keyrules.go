@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// reservedSegments are never allowed, because HTTP clients and proxies resolve them in the request path
+var reservedSegments = []string{".", ".."}
+
+// compile prepares the charset of the rules
+func (r *KeyRules) compile() error {
+	if r.Charset == "" {
+		r.charset = nil
+		return nil
+	}
+
+	charset, err := regexp.Compile("^[" + r.Charset + "]*$")
+	if err != nil {
+		return fmt.Errorf("invalid charset %q: %w", r.Charset, err)
+	}
+	r.charset = charset
+	return nil
+}
+
+// problems returns every reason why key may not be written. Keys must be valid UTF-8, must not
+// start with "/", contain empty segments, whitespace or control characters, or "." and ".."
+// segments. The configured rules are checked in addition.
+func (r KeyRules) problems(key string) []string {
+	if key == "" {
+		return []string{"key is empty"}
+	}
+
+	var problems []string
+	if !utf8.ValidString(key) {
+		problems = append(problems, "key is not valid UTF-8")
+	}
+	if strings.IndexFunc(key, func(c rune) bool { return unicode.IsSpace(c) || unicode.IsControl(c) }) >= 0 {
+		problems = append(problems, "key contains whitespace or control characters")
+	}
+	if strings.HasPrefix(key, "/") {
+		problems = append(problems, "key starts with '/'")
+	}
+	if r.MaxLength > 0 && len(key) > r.MaxLength {
+		problems = append(problems, fmt.Sprintf("key is %d bytes long, more than the maximum of %d", len(key), r.MaxLength))
+	}
+
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	if r.MaxDepth > 0 && len(segments) > r.MaxDepth {
+		problems = append(problems, fmt.Sprintf("key has %d segments, more than the maximum of %d", len(segments), r.MaxDepth))
+	}
+
+	for _, segment := range segments {
+		if problem := r.segmentProblem(segment); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	return problems
+}
+
+func (r KeyRules) segmentProblem(segment string) string {
+	if segment == "" {
+		return "key contains an empty segment"
+	}
+
+	for _, reserved := range reservedSegments {
+		if segment == reserved {
+			return fmt.Sprintf("segment %q is not allowed", segment)
+		}
+	}
+	for _, pattern := range r.ForbiddenSegments {
+		if ok, _ := path.Match(pattern, segment); ok {
+			return fmt.Sprintf("segment %q is forbidden", segment)
+		}
+	}
+
+	if r.charset != nil && utf8.ValidString(segment) && !r.charset.MatchString(segment) {
+		return fmt.Sprintf("segment %q contains characters outside [%s]", segment, r.Charset)
+	}
+
+	return ""
+}
+
+// validateKeys checks the key of every pair against the rules and reports every offending key
+func validateKeys(pairs []KVPair, rules KeyRules) error {
+	var diagnostics []Diagnostic
+
+	for _, pair := range pairs {
+		problems := rules.problems(pair.Key)
+		if len(problems) == 0 {
+			continue
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Category: CategoryInvalidKey,
+			File:     pair.File,
+			Line:     pair.Line,
+			Key:      pair.Key,
+			Message:  fmt.Sprintf("%q: %s", pair.Key, strings.Join(problems, "; ")),
+		})
+	}
+
+	return diagnosticListError("%d invalid keys", diagnostics)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestKeyRulesProblems(t *testing.T) {
+	configured := KeyRules{
+		Charset:           "a-z0-9_-",
+		MaxDepth:          3,
+		MaxLength:         20,
+		ForbiddenSegments: []string{"tmp", "_*"},
+	}
+	if err := configured.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		rules KeyRules
+		key   string
+		want  []string
+	}{
+		{name: "valid", key: "app/server/port"},
+		{name: "valid with any charset by default", key: "App/Ünïcode.key@1"},
+		{name: "empty", key: "", want: []string{"key is empty"}},
+		{name: "leading slash", key: "/app/port", want: []string{"key starts with '/'"}},
+		{name: "double slash", key: "app//port", want: []string{"key contains an empty segment"}},
+		{name: "trailing slash", key: "app/", want: []string{"key contains an empty segment"}},
+		{name: "space", key: "app/my key", want: []string{"key contains whitespace or control characters"}},
+		{name: "control character", key: "app/a\x01", want: []string{"key contains whitespace or control characters"}},
+		{name: "not UTF-8", key: "app/\xff", want: []string{"key is not valid UTF-8"}},
+		{name: "dot segments", key: "app/../port", want: []string{`segment ".." is not allowed`}},
+		{name: "configured valid", rules: configured, key: "app/server/port"},
+		{name: "too deep", rules: configured, key: "a/b/c/d", want: []string{"key has 4 segments, more than the maximum of 3"}},
+		{name: "too long", rules: configured, key: "app/abcdefghijklmnopq", want: []string{"key is 21 bytes long, more than the maximum of 20"}},
+		{name: "forbidden segment", rules: configured, key: "app/tmp/x", want: []string{`segment "tmp" is forbidden`}},
+		{name: "forbidden pattern", rules: configured, key: "app/_internal", want: []string{`segment "_internal" is forbidden`}},
+		{name: "charset", rules: configured, key: "app/Port", want: []string{`segment "Port" contains characters outside [a-z0-9_-]`}},
+		{
+			name:  "several problems",
+			rules: configured,
+			key:   "/App/a//b",
+			want: []string{
+				"key starts with '/'",
+				"key has 4 segments, more than the maximum of 3",
+				`segment "App" contains characters outside [a-z0-9_-]`,
+				"key contains an empty segment",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rules.problems(tt.key)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("problems(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateKeys(t *testing.T) {
+	pairs := []KVPair{
+		{Key: "app/name", File: "app.yaml", Line: 1},
+		{Key: "app/my key", File: "app.yaml", Line: 2},
+		{Key: "app//port", File: "other.yaml", Line: 7},
+	}
+
+	err := validateKeys(pairs, KeyRules{})
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) {
+		t.Fatalf("validateKeys() error = %v, want a DiagnosticError", err)
+	}
+	if len(diagErr.Diagnostics) != 2 {
+		t.Fatalf("diagnostics = %+v, want 2", diagErr.Diagnostics)
+	}
+	for i, want := range []string{"app.yaml:2", "other.yaml:7"} {
+		diag := diagErr.Diagnostics[i]
+		if formatLocation(diag.File, diag.Line) != want || diag.Category != CategoryInvalidKey {
+			t.Errorf("diagnostic %d = %+v, want %s", i, diag, want)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "2 invalid keys:") {
+		t.Errorf("error = %v", err)
+	}
+
+	if err := validateKeys(pairs[:1], KeyRules{}); err != nil {
+		t.Errorf("validateKeys() with valid keys error = %v", err)
+	}
+}
+
+func TestKeyRulesUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "valid", content: "files: [a.yaml]\nkey_rules:\n  charset: a-z0-9/_.-\n  max_depth: 5\n"},
+		{name: "invalid charset", content: "files: [a.yaml]\nkey_rules:\n  charset: z-a\n", wantErr: "line 3: invalid charset"},
+		{name: "negative limit", content: "files: [a.yaml]\nkey_rules:\n  max_length: -1\n", wantErr: "line 3: max_depth and max_length must not be negative"},
+		{name: "unknown setting", content: "files: [a.yaml]\nkey_rules:\n  max_size: 1\n", wantErr: "line 3: unknown setting 'max_size'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var env Environment
+			err := yaml.Unmarshal([]byte(tt.content), &env)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				if env.KeyRules.charset == nil || env.KeyRules.MaxDepth != 5 {
+					t.Errorf("KeyRules = %+v", env.KeyRules)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unmarshal() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// newLogger creates a leveled logger writing in the given format to w
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level '%s' (supported: debug, info, warn, error)", level)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: slogLevel}
+
+	switch strings.ToLower(format) {
+	case LogFormatText:
+		return slog.New(slog.NewTextHandler(w, handlerOpts)), nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, handlerOpts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format '%s' (supported: %s, %s)", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// runLogAttrs returns the attributes attached to every log record of a run
+func runLogAttrs(opts Options) []any {
+	var attrs []any
+	if opts.Environment != "" {
+		attrs = append(attrs, "env", opts.Environment)
+	}
+	return append(attrs, "datacenter", opts.Datacenter)
+}
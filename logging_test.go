@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, LogFormatJSON, "info")
+	if err != nil {
+		t.Fatalf("newLogger() error = %v", err)
+	}
+
+	logger = logger.With(runLogAttrs(Options{Environment: "production", Datacenter: "dc1"})...)
+	logger.Debug("hidden")
+	logger.Info("syncing", "batch", 2, "key", "app/name")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+
+	for field, want := range map[string]interface{}{
+		"msg":        "syncing",
+		"env":        "production",
+		"datacenter": "dc1",
+		"batch":      float64(2),
+		"key":        "app/name",
+	} {
+		if record[field] != want {
+			t.Errorf("record[%q] = %v, want %v", field, record[field], want)
+		}
+	}
+}
+
+func TestNewLoggerInvalid(t *testing.T) {
+	if _, err := newLogger(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := newLogger(&bytes.Buffer{}, LogFormatText, "loud"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
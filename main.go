@@ -1,103 +1,344 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const (
 	DefaultConsulAddr = "http://127.0.0.1:8500"
 	DefaultDatacenter = "dc1"
 	DefaultConfigFile = "./environments.yaml"
+	DefaultBackupDir  = "."
+	DefaultPullDir    = "."
+	DefaultLogLevel   = "info"
+)
+
+// Exit codes
+const (
+	ExitError = 1
+	ExitDrift = 2
 )
 
 func main() {
-	// Define command line flags
-	var (
-		environment = flag.String("env", "", "Environment name (required)")
-		configFile  = flag.String("config", DefaultConfigFile, "Path to environments configuration file")
-		dryRun      = flag.Bool("dry-run", false, "Perform a dry run without making actual changes")
-		export      = flag.Bool("export", false, "Export KV pairs in Consul JSON format to stdout")
-		consulAddr  = flag.String("consul-addr", DefaultConsulAddr, "Consul HTTP API address")
-		datacenter  = flag.String("datacenter", DefaultDatacenter, "Consul datacenter")
-		verbose     = flag.Bool("verbose", false, "Enable verbose output")
-	)
-
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s -env <environment> [options]\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "consul-kv-sync synchronizes YAML files to Consul KV store.\n\n")
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// runLegacy runs the single flag set of earlier versions, in which the mode is selected by flags
+func runLegacy(args []string) int {
+	s := newCLISettings()
+	fs := flag.NewFlagSet(programName(), flag.ContinueOnError)
+	for _, register := range []func(*flag.FlagSet, *cliSettings){environmentFlags, writeFlags, consulFlags, logFlags, loadFlags, interpolateFlags, reportFlag} {
+		register(fs, s)
+	}
+	fs.BoolVar(&s.Export, "export", false, "Export KV pairs in Consul JSON format to stdout")
+	fs.StringVar(&s.Restore, "restore", "", "Restore KV pairs from a backup file (same as -import)")
+	fs.StringVar(&s.Import, "import", "", "Import KV pairs from a Consul JSON export file ('-' for stdin) instead of YAML files")
+	fs.StringVar(&s.Pull, "pull", "", "Generate YAML files from the keys under this Consul prefix ('/' for all keys)")
+	fs.StringVar(&s.PullDir, "pull-dir", s.PullDir, "Directory to write files generated by -pull to")
+	fs.BoolVar(&s.Split, "split", false, "With -pull, write one file per top-level key")
+	fs.BoolVar(&s.Check, "check", false, "Compare Consul with the YAML files without writing; exit with status 2 on drift")
+	fs.BoolVar(&s.CheckExtra, "check-extra", false, "With -check, also report keys that exist in Consul but not in the YAML files")
+	fs.BoolVar(&s.Validate, "validate", false, "Only load the files and check them for duplicate, invalid and disallowed keys, schema violations and value sizes, without contacting Consul")
+
+	name := programName()
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -env <environment> [options]\n", name)
+		fmt.Fprintf(os.Stderr, "       %s -import <file|-> [options]\n", name)
+		fmt.Fprintf(os.Stderr, "       %s -pull <prefix> [-env <environment>] [options]\n\n", name)
+		fmt.Fprintf(os.Stderr, "consul-kv-sync synchronizes YAML files to Consul KV store.\n")
+		fmt.Fprintf(os.Stderr, "These flags are kept for compatibility; run '%s help' for the commands that replace them.\n\n", name)
 		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
+		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
-		fmt.Fprintf(os.Stderr, "  %s -env production\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -env staging -dry-run\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -env production -export > production-kv.json\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -env production -consul-addr http://consul:8500 -verbose\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -env production\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env staging -dry-run\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -export > production-kv.json\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -consul-addr http://consul:8500 -verbose\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -log-format json -log-level debug\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -timeout 5m\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -backup -backup-dir ./backups\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -restore ./backups/production-20240101T000000Z.json\n", name)
+		fmt.Fprintf(os.Stderr, "  consul kv export app/ | %s -import - -dry-run\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -output json > result.json\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -report junit=report.xml -report github\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -check -check-extra\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -env production -validate -report github\n", name)
+		fmt.Fprintf(os.Stderr, "  IMAGE_TAG=$(git rev-parse --short HEAD) %s -env production -interpolate -strict\n", name)
+		fmt.Fprintf(os.Stderr, "  %s -pull app -split -pull-dir kv-files/production -env production\n", name)
 	}
 
-	flag.Parse()
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return ExitError
+	}
+	applyVerbose(fs, s)
 
 	// Validate required flags
-	if *environment == "" {
+	if s.Restore != "" && s.Import != "" {
+		fmt.Fprintf(os.Stderr, "Error: -restore and -import cannot be used together\n\n")
+		fs.Usage()
+		return ExitError
+	}
+
+	if err := checkOutput(s.Output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		fs.Usage()
+		return ExitError
+	}
+
+	if err := checkModeFlags(s); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		fs.Usage()
+		return ExitError
+	}
+
+	if s.Validate && s.Environment == "" {
+		fmt.Fprintf(os.Stderr, "Error: -validate requires -env\n\n")
+		fs.Usage()
+		return ExitError
+	}
+
+	if s.Environment == "" && s.Restore == "" && s.Import == "" && s.Pull == "" {
 		fmt.Fprintf(os.Stderr, "Error: -env flag is required\n\n")
-		flag.Usage()
-		os.Exit(1)
+		fs.Usage()
+		return ExitError
 	}
 
-	// Set up logging
-	if !*verbose {
-		log.SetOutput(io.Discard)
+	return execute(s)
+}
+
+// checkModeFlags rejects legacy flags that select different modes, like -check -export, of which
+// only one would run, and modes that -import, -restore or -pull would ignore
+func checkModeFlags(s *cliSettings) error {
+	var set []string
+	for _, mode := range []struct {
+		name string
+		set  bool
+	}{
+		{"-check", s.Check},
+		{"-export", s.Export},
+		{"-validate", s.Validate},
+		{"-dry-run", s.DryRun},
+	} {
+		if mode.set {
+			set = append(set, mode.name)
+		}
 	}
 
-	// Execute main logic
-	if err := run(*environment, *configFile, *dryRun, *export, *consulAddr, *datacenter, *verbose); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	if len(set) > 1 {
+		return fmt.Errorf("%s and %s cannot be used together", strings.Join(set[:len(set)-1], ", "), set[len(set)-1])
 	}
+
+	// -import, -restore and -pull replace the sync with their own mode, which only -import and
+	// -restore can run as a dry run
+	for _, source := range []struct {
+		name   string
+		set    bool
+		dryRun bool
+	}{
+		{"-import", s.Import != "", true},
+		{"-restore", s.Restore != "", true},
+		{"-pull", s.Pull != "", false},
+	} {
+		if !source.set || len(set) == 0 || (set[0] == "-dry-run" && source.dryRun) {
+			continue
+		}
+		return fmt.Errorf("%s cannot be used with %s", set[0], source.name)
+	}
+	return nil
 }
 
-func run(environment, configFile string, dryRun, export bool, consulAddr, datacenter string, verbose bool) error {
+// newRunContext returns a context that is cancelled on SIGINT/SIGTERM or when the timeout expires.
+// After the first signal the handler is released, so a second Ctrl-C terminates immediately.
+func newRunContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancelTimeout()
+		stop()
+	}
+}
+
+func run(ctx context.Context, opts Options, report *RunReport) error {
+	if opts.Pull != "" {
+		return runPull(ctx, opts)
+	}
+
+	if opts.Restore != "" {
+		return runImport(ctx, opts, opts.Restore, report)
+	}
+
+	if opts.Import != "" {
+		return runImport(ctx, opts, opts.Import, report)
+	}
+
 	// Load configuration and files
-	kvMaps, filenames, err := loadConfigurationAndFiles(environment, configFile, verbose)
+	loadOpts := LoadOptions{Strict: opts.Strict, SingleDocument: !opts.MultiDoc}
+	env, sources, err := loadConfigurationAndFiles(opts.Environment, opts.ConfigFile, loadOpts)
 	if err != nil {
 		return err
 	}
+	sensitive := SensitiveRules{Patterns: env.SensitiveKeys}
+
+	for _, source := range sources {
+		report.Files = append(report.Files, source.Path)
+	}
 
 	// Check for duplicates
-	if err := checkDuplicates(kvMaps, filenames, verbose); err != nil {
+	if err := checkDuplicates(sources, sensitive); err != nil {
 		return err
 	}
 
 	// Collect and process KV pairs
-	allPairs := collectAllKVPairs(kvMaps)
-	if verbose {
-		fmt.Printf("Collected %d key-value pairs\n", len(allPairs))
+	allPairs := collectAllKVPairs(sources)
+	markSensitivePairs(allPairs, sensitive)
+	slog.Debug("collected key-value pairs", "count", len(allPairs))
+
+	if err := validateKeys(allPairs, env.KeyRules); err != nil {
+		return err
+	}
+
+	if err := checkKeyPrefixes(allPairs, env.AllowedPrefixes, env.DeniedPrefixes); err != nil {
+		return err
+	}
+
+	// Handle validate mode, which needs neither Consul nor the variables of -interpolate
+	if opts.Validate {
+		if err := validateSchemas(sources, allPairs, env.Schema, opts.ConfigFile, sensitive, opts.Interpolate); err != nil {
+			return err
+		}
+		if err := checkValueSizes(allPairs, opts.MaxSize); err != nil {
+			return err
+		}
+		fmt.Fprintf(statusWriter(opts), "Validation passed: %d keys in %d files\n", len(allPairs), len(sources))
+		return nil
+	}
+
+	if opts.Interpolate {
+		if err := interpolatePairs(allPairs, opts.Strict); err != nil {
+			return err
+		}
+	}
+
+	// Values are validated as they are written, after interpolation
+	if err := validateSchemas(sources, allPairs, env.Schema, opts.ConfigFile, sensitive, false); err != nil {
+		return err
+	}
+
+	if err := checkValueSizes(allPairs, opts.MaxSize); err != nil {
+		return err
 	}
 
 	// Handle export mode
-	if export {
+	if opts.Export {
 		return exportToJSON(allPairs)
 	}
 
+	return applyKVPairs(ctx, opts, allPairs, report)
+}
+
+// runImport pushes the contents of a Consul JSON export or backup file to Consul
+func runImport(ctx context.Context, opts Options, path string, report *RunReport) error {
+	slog.Debug("loading key-value pairs", "file", displayImportPath(path))
+
+	pairs, err := readImportFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load import file: %w", err)
+	}
+	markSensitivePairs(pairs, SensitiveRules{})
+
+	// Like the pairs of YAML files, so the plan, the batches and the output do not depend on the file order
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+
+	slog.Debug("collected key-value pairs", "count", len(pairs))
+
+	if path != StdinPath {
+		report.Files = append(report.Files, path)
+	}
+
+	// There is no environment, so only the built-in key rules apply
+	if err := validateKeys(pairs, KeyRules{}); err != nil {
+		return err
+	}
+
+	if err := checkValueSizes(pairs, opts.MaxSize); err != nil {
+		return err
+	}
+
+	return applyKVPairs(ctx, opts, pairs, report)
+}
+
+// applyKVPairs compares the pairs with Consul in check mode, displays them in dry-run mode, or backs up the affected key space
+// when requested and syncs the pairs to Consul
+func applyKVPairs(ctx context.Context, opts Options, pairs []KVPair, report *RunReport) error {
+	// Handle drift check, which never writes
+	if opts.Check {
+		client := NewConsulClient(opts.ConsulAddr, opts.Datacenter)
+		return checkDrift(ctx, client, pairs, opts.CheckExtra)
+	}
+
 	// Handle dry run
-	if dryRun {
+	if opts.DryRun {
 		fmt.Println("\n[DRY RUN MODE] No changes will be made to Consul")
-		fmt.Println(formatKVPairsForDisplay(allPairs))
+		fmt.Println(formatKVPairsForDisplay(pairs))
 		return nil
 	}
 
+	client := NewConsulClient(opts.ConsulAddr, opts.Datacenter)
+
+	// Read the current state once; it is both the backup and the base of the sync plan.
+	// Without it, e.g. with a write-only token, no key is skipped
+	var plan SyncPlan
+	existing, err := fetchKeySpace(ctx, client, pairs)
+	switch {
+	case err == nil:
+		plan = planSync(pairs, existing)
+	case opts.Backup || ctx.Err() != nil:
+		return fmt.Errorf("failed to read current values, nothing was synced: %w", err)
+	default:
+		slog.Warn("failed to read current values, unchanged keys are written too", "error", err)
+		plan = SyncPlan{Pending: pairs, Unknown: true}
+	}
+
+	if opts.Backup {
+		path, err := backupKeySpace(existing, opts.BackupDir, backupName(opts))
+		if err != nil {
+			return fmt.Errorf("backup failed, nothing was synced: %w", err)
+		}
+		slog.Info("backed up existing keys", "file", path, "count", len(existing))
+	}
+
 	// Sync to Consul
-	return syncToConsul(allPairs, consulAddr, datacenter, verbose)
+	return syncToConsul(ctx, client, pairs, plan, opts, report)
 }
 
-func loadConfigurationAndFiles(environment, configFile string, verbose bool) ([]map[string]interface{}, []string, error) {
+func loadConfigurationAndFiles(environment, configFile string, loadOpts LoadOptions) (*Environment, []*SourceFile, error) {
 	// Step 1: Load environment configuration
-	if verbose {
-		fmt.Printf("Loading configuration from %s...\n", configFile)
-	}
+	slog.Debug("loading configuration", "file", configFile)
 
 	config, err := loadEnvironments(configFile)
 	if err != nil {
@@ -105,67 +346,102 @@ func loadConfigurationAndFiles(environment, configFile string, verbose bool) ([]
 	}
 
 	// Step 2: Get files for the specified environment
-	files, err := getEnvironmentFiles(config, environment)
+	env, err := getEnvironment(config, environment)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if verbose {
-		fmt.Printf("Found %d files for environment '%s'\n", len(files), environment)
-	}
+	slog.Debug("found files for environment", "count", len(env.Files))
 
 	// Step 3: Resolve file paths
-	resolvedPaths := resolveFilePaths(configFile, files)
+	entries := resolveFileEntries(configFile, env.Files)
 
-	// Step 4: Load all YAML files
-	if verbose {
-		fmt.Println("Loading YAML files...")
-	}
+	// Step 4: Load all files
+	slog.Debug("loading files")
 
-	kvMaps, filenames, err := loadAllYAMLFiles(resolvedPaths)
+	loadOpts.Variables = env.Variables
+	sources, err := loadAllSourceFiles(entries, loadOpts)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load YAML files: %w", err)
+		return nil, nil, fmt.Errorf("failed to load files: %w", err)
 	}
 
-	return kvMaps, filenames, nil
-}
-
-func checkDuplicates(kvMaps []map[string]interface{}, filenames []string, verbose bool) error {
-	if verbose {
-		fmt.Println("Checking for duplicate keys...")
+	if len(env.FileValues) > 0 {
+		source, err := loadFileValues(configFile, env.FileValues)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, source)
 	}
 
-	duplicates, err := detectDuplicates(kvMaps, filenames)
-	if err != nil {
-		return fmt.Errorf("failed to detect duplicates: %w", err)
+	documents := DocumentRules{JSON: env.JSONDocuments, YAML: env.YAMLDocuments}
+	if err := encodeDocumentKeys(sources, documents, SensitiveRules{Patterns: env.SensitiveKeys}); err != nil {
+		return nil, nil, err
 	}
+	applyFlagRules(sources, env.Flags)
+
+	return env, sources, nil
+}
+
+func checkDuplicates(sources []*SourceFile, sensitive SensitiveRules) error {
+	slog.Debug("checking for duplicate keys", "files", len(sources))
 
+	duplicates := detectSourceDuplicates(sources)
+	markSensitiveDuplicates(duplicates, sensitive)
 	if len(duplicates) > 0 {
 		fmt.Fprintln(os.Stderr, formatDuplicateError(duplicates))
-		return fmt.Errorf("duplicate keys detected")
+		return &DiagnosticError{Message: "duplicate keys detected", Diagnostics: duplicateDiagnostics(duplicates)}
 	}
 
 	return nil
 }
 
-func syncToConsul(allPairs []KVPair, consulAddr, datacenter string, verbose bool) error {
-	fmt.Printf("Syncing %d key-value pairs to Consul KV store...\n", len(allPairs))
+func syncToConsul(ctx context.Context, client *ConsulClient, allPairs []KVPair, plan SyncPlan, opts Options, report *RunReport) error {
+	if plan.Unknown {
+		slog.Info("syncing key-value pairs to Consul KV store", "total", len(allPairs))
+	} else {
+		slog.Info("syncing key-value pairs to Consul KV store",
+			"total", len(allPairs), "added", len(plan.Added), "changed", len(plan.Changed), "unchanged", len(plan.Unchanged))
+	}
 
-	client := NewConsulClient(consulAddr, datacenter)
-	summary, err := client.syncKVPairs(allPairs, verbose)
+	startedAt := time.Now()
+	summary, err := client.syncKVPairs(ctx, plan.Pending)
 
 	// Always display summary if available
 	if summary != nil {
-		fmt.Println(formatExecutionSummary(summary))
+		summary.TotalKeys = len(allPairs)
+		summary.AddedKeys = len(plan.Added)
+		summary.ChangedKeys = len(plan.Changed)
+		summary.SkippedKeys = len(plan.Unchanged)
+		summary.CountsUnknown = plan.Unknown
+		summary.StartedAt = startedAt
+		summary.Duration = time.Since(startedAt)
+		report.Summary = summary
+
+		if outputErr := writeExecutionSummary(os.Stdout, summary, opts.Output); outputErr != nil {
+			return outputErr
+		}
 	}
 
 	if err != nil && summary == nil {
 		return fmt.Errorf("failed to sync KV pairs: %w", err)
 	}
 
+	if summary != nil && summary.Aborted {
+		return fmt.Errorf("sync aborted (%s) after %d of %d batches", summary.AbortReason, summary.SuccessBatches, summary.TotalBatches)
+	}
+
 	if summary != nil && summary.FailedBatches > 0 {
 		return fmt.Errorf("%d out of %d batches failed", summary.FailedBatches, summary.TotalBatches)
 	}
 
 	return nil
 }
+
+// statusWriter returns where console reports go: stdout for text output, stderr when
+// stdout is reserved for a machine-readable document
+func statusWriter(opts Options) io.Writer {
+	if opts.Output == OutputJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
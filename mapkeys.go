@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stringifyMapKeys retags the keys below node that YAML resolves to something other than a string,
+// like 8080, true or null, as strings, so they keep the text they are written with instead of being
+// decoded as numbers, booleans or nil. Every such key is logged as a warning, or is an error when strict.
+// Paths are reported relative to filePath, the file containing node.
+func stringifyMapKeys(node *yaml.Node, prefix, filePath string, included map[*yaml.Node]string, strict bool) error {
+	if includedPath, ok := included[node]; ok {
+		filePath = includedPath
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			if tag := keyNode.ShortTag(); keyNode.Kind == yaml.ScalarNode && tag != "!!str" && tag != "!!merge" {
+				key := buildKey(prefix, keyNode.Value)
+				if strict {
+					return fmt.Errorf("line %d: key '%s' is a YAML %s, quote it to use it as a string", keyNode.Line, key, strings.TrimPrefix(tag, "!!"))
+				}
+				slog.Warn("map key is not a string, using it as written", "file", filePath, "line", keyNode.Line, "key", key, "type", strings.TrimPrefix(tag, "!!"))
+				keyNode.Tag = "!!str"
+			}
+
+			// The keys of a merged mapping are merged into this one
+			valuePrefix := buildKey(prefix, keyNode.Value)
+			if keyNode.ShortTag() == "!!merge" {
+				valuePrefix = prefix
+			}
+			if err := stringifyMapKeys(valueNode, valuePrefix, filePath, included, strict); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := stringifyMapKeys(item, prefix, filePath, included, strict); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// mapKeyString returns the key of a map decoded with non-string keys as text
+func mapKeyString(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(k)
+	}
+}
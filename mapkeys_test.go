@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const nonStringKeysYAML = `ports:
+  8080: http
+  0x1F: hex
+  1.50: float
+defaults: &defaults
+  true: on
+services:
+  <<: *defaults
+  false: off
+  ~: nothing
+  null: spelled
+  2024-01-01: date
+"443": quoted
+`
+
+func TestLoadNonStringMapKeys(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{"app.yaml": nonStringKeysYAML})
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+
+	source, err := loadSourceFile(filepath.Join(dir, "app.yaml"), LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	expected := map[string]struct {
+		value string
+		line  int
+	}{
+		"ports/8080":          {"http", 2},
+		"ports/0x1F":          {"hex", 3},
+		"ports/1.50":          {"float", 4},
+		"defaults/true":       {"on", 6},
+		"services/true":       {"on", 6},
+		"services/false":      {"off", 9},
+		"services/~":          {"nothing", 10},
+		"services/null":       {"spelled", 11},
+		"services/2024-01-01": {"date", 12},
+		"443":                 {"quoted", 13},
+	}
+
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	if len(pairs) != len(expected) {
+		t.Errorf("got %d pairs, want %d: %+v", len(pairs), len(expected), pairs)
+	}
+	for _, pair := range pairs {
+		want, ok := expected[pair.Key]
+		if !ok || pair.Value != want.value || pair.Line != want.line {
+			t.Errorf("%s = %q at line %d, want %q at line %d", pair.Key, pair.Value, pair.Line, want.value, want.line)
+		}
+	}
+
+	// Merged keys are reported where they are written, so "true" of defaults is reported once
+	if got := strings.Count(logs.String(), "map key is not a string"); got != 8 {
+		t.Errorf("logged %d warnings, want 8:\n%s", got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "line=2 key=ports/8080 type=int") {
+		t.Errorf("warning for ports/8080 not logged:\n%s", logs.String())
+	}
+}
+
+func TestLoadNonStringMapKeysStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "number", content: "ports:\n  http: 80\n  8080: alt\n", want: "line 3: key 'ports/8080' is a YAML int"},
+		{name: "boolean", content: "flags:\n  true: yes\n", want: "line 2: key 'flags/true' is a YAML bool"},
+		{name: "null", content: "a:\n  b:\n    ~: x\n", want: "line 3: key 'a/b/~' is a YAML null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, t.TempDir(), map[string]string{"app.yaml": tt.content})
+
+			_, err := loadSourceFile(filepath.Join(dir, "app.yaml"), LoadOptions{Strict: true})
+			var diagErr *DiagnosticError
+			if !errors.As(err, &diagErr) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("loadSourceFile() error = %v, want %q", err, tt.want)
+			}
+			if diagErr.Diagnostics[0].Category != CategoryLoad {
+				t.Errorf("diagnostic = %+v", diagErr.Diagnostics[0])
+			}
+		})
+	}
+}
+
+func TestProcessInterfaceMapKeys(t *testing.T) {
+	pairs := processValue("m", map[interface{}]interface{}{
+		8080:  "int",
+		true:  "bool",
+		nil:   "null",
+		"str": "string",
+	})
+
+	got := make(map[string]string)
+	for _, pair := range pairs {
+		got[pair.Key] = pair.Value
+	}
+	for key, want := range map[string]string{"m/8080": "int", "m/true": "bool", "m/null": "null", "m/str": "string"} {
+		if got[key] != want {
+			t.Errorf("%s = %q, want %q (pairs: %+v)", key, got[key], want, pairs)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+
+	// SummaryDocumentVersion is bumped whenever a field of SummaryDocument changes incompatibly
+	SummaryDocumentVersion = 1
+)
+
+// SummaryDocument is the stable JSON representation of an ExecutionSummary
+type SummaryDocument struct {
+	Version     int               `json:"version"`
+	Status      string            `json:"status"`
+	StartedAt   string            `json:"started_at"`
+	DurationMS  int64             `json:"duration_ms"`
+	Aborted     bool              `json:"aborted"`
+	AbortReason string            `json:"abort_reason,omitempty"`
+	Keys        SummaryKeyCounts  `json:"keys"`
+	Batches     SummaryBatchCount `json:"batches"`
+	Results     []BatchDocument   `json:"results"`
+}
+
+// SummaryKeyCounts counts the desired keys by what the sync did with them. Added, Changed and
+// Skipped are null when Consul could not be read before the sync, so no key was skipped
+type SummaryKeyCounts struct {
+	Total   int  `json:"total"`
+	Added   *int `json:"added"`
+	Changed *int `json:"changed"`
+	Skipped *int `json:"skipped"`
+}
+
+// SummaryBatchCount counts the transaction batches by outcome
+type SummaryBatchCount struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+}
+
+// BatchDocument is the JSON representation of a BatchResult
+type BatchDocument struct {
+	Batch       int               `json:"batch"`
+	Success     bool              `json:"success"`
+	Interrupted bool              `json:"interrupted"`
+	Operations  int               `json:"operations"`
+	DurationMS  int64             `json:"duration_ms"`
+	Error       string            `json:"error,omitempty"`
+	Keys        []string          `json:"keys"`
+	OpErrors    []OpErrorDocument `json:"op_errors"`
+}
+
+// OpErrorDocument is the JSON representation of a TxnError resolved to its key
+type OpErrorDocument struct {
+	OpIndex int    `json:"op_index"`
+	Key     string `json:"key"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Value   string `json:"value"`
+	Error   string `json:"error"`
+}
+
+// writeExecutionSummary writes the summary in the requested output format
+func writeExecutionSummary(w io.Writer, summary *ExecutionSummary, format string) error {
+	if format != OutputJSON {
+		_, err := fmt.Fprintln(w, formatExecutionSummary(summary))
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(buildSummaryDocument(summary)); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	return nil
+}
+
+// buildSummaryDocument converts an ExecutionSummary into its JSON document
+func buildSummaryDocument(summary *ExecutionSummary) SummaryDocument {
+	doc := SummaryDocument{
+		Version:     SummaryDocumentVersion,
+		Status:      summaryStatus(summary),
+		StartedAt:   summary.StartedAt.UTC().Format(time.RFC3339Nano),
+		DurationMS:  summary.Duration.Milliseconds(),
+		Aborted:     summary.Aborted,
+		AbortReason: summary.AbortReason,
+		Keys:        SummaryKeyCounts{Total: summary.TotalKeys},
+		Batches: SummaryBatchCount{
+			Total:     summary.TotalBatches,
+			Succeeded: summary.SuccessBatches,
+			Failed:    summary.FailedBatches,
+			Skipped:   summary.SkippedBatches,
+		},
+		Results: make([]BatchDocument, 0, len(summary.Results)),
+	}
+	if !summary.CountsUnknown {
+		doc.Keys.Added = &summary.AddedKeys
+		doc.Keys.Changed = &summary.ChangedKeys
+		doc.Keys.Skipped = &summary.SkippedKeys
+	}
+
+	for _, result := range summary.Results {
+		batch := BatchDocument{
+			Batch:       result.BatchIndex + 1,
+			Success:     result.Success,
+			Interrupted: result.Interrupted,
+			Operations:  result.ProcessedOps,
+			DurationMS:  result.Duration.Milliseconds(),
+			Keys:        make([]string, len(result.Pairs)),
+			OpErrors:    make([]OpErrorDocument, 0, len(result.OpErrors)),
+		}
+		for i, pair := range result.Pairs {
+			batch.Keys[i] = pair.Key
+		}
+		if result.Error != nil {
+			batch.Error = result.Error.Error()
+		}
+
+		for _, opErr := range result.OpErrors {
+			pair, _ := opErrorPair(result, opErr)
+			batch.OpErrors = append(batch.OpErrors, OpErrorDocument{
+				OpIndex: opErr.OpIndex,
+				Key:     pair.Key,
+				File:    pair.File,
+				Line:    pair.Line,
+				Value:   displayValue(pair.Value, pair.Sensitive),
+				Error:   opErr.What,
+			})
+		}
+
+		doc.Results = append(doc.Results, batch)
+	}
+
+	return doc
+}
+
+// summaryStatus condenses the summary into one of success, partial, failed or aborted
+func summaryStatus(summary *ExecutionSummary) string {
+	switch {
+	case summary.Aborted:
+		return "aborted"
+	case summary.SuccessBatches == summary.TotalBatches:
+		return "success"
+	case summary.SuccessBatches > 0:
+		return "partial"
+	default:
+		return "failed"
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteExecutionSummaryJSON(t *testing.T) {
+	summary := &ExecutionSummary{
+		TotalKeys:      5,
+		AddedKeys:      2,
+		ChangedKeys:    1,
+		SkippedKeys:    2,
+		TotalBatches:   2,
+		SuccessBatches: 1,
+		FailedBatches:  1,
+		StartedAt:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:       1500 * time.Millisecond,
+		Results: []BatchResult{
+			{BatchIndex: 0, Success: true, ProcessedOps: 2, Pairs: []KVPair{{Key: "app/a"}, {Key: "app/b"}}},
+			{
+				BatchIndex:   1,
+				ProcessedOps: 1,
+				Pairs:        []KVPair{{Key: "app/c", Value: "eighty", File: "app.yaml", Line: 7}},
+				Error:        errors.New("transaction rolled back with 1 errors"),
+				OpErrors:     []TxnError{{OpIndex: 0, What: "invalid value"}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeExecutionSummary(&buf, summary, OutputJSON); err != nil {
+		t.Fatalf("writeExecutionSummary() error = %v", err)
+	}
+
+	var doc SummaryDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if doc.Version != SummaryDocumentVersion || doc.Status != "partial" {
+		t.Errorf("version/status = %d/%s, want %d/partial", doc.Version, doc.Status, SummaryDocumentVersion)
+	}
+	if doc.StartedAt != "2024-01-02T03:04:05Z" || doc.DurationMS != 1500 {
+		t.Errorf("started_at/duration_ms = %s/%d", doc.StartedAt, doc.DurationMS)
+	}
+	if keys, _ := json.Marshal(doc.Keys); string(keys) != `{"total":5,"added":2,"changed":1,"skipped":2}` {
+		t.Errorf("keys = %s", keys)
+	}
+	if len(doc.Results) != 2 || len(doc.Results[1].OpErrors) != 1 {
+		t.Fatalf("results = %+v", doc.Results)
+	}
+
+	opErr := doc.Results[1].OpErrors[0]
+	expected := OpErrorDocument{OpIndex: 0, Key: "app/c", File: "app.yaml", Line: 7, Value: "eighty", Error: "invalid value"}
+	if opErr != expected {
+		t.Errorf("op error = %+v, want %+v", opErr, expected)
+	}
+}
+
+func TestWriteExecutionSummaryUnknownCounts(t *testing.T) {
+	summary := &ExecutionSummary{TotalKeys: 3, CountsUnknown: true, TotalBatches: 1, SuccessBatches: 1}
+
+	var buf bytes.Buffer
+	if err := writeExecutionSummary(&buf, summary, OutputJSON); err != nil {
+		t.Fatalf("writeExecutionSummary() error = %v", err)
+	}
+
+	var doc SummaryDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if keys, _ := json.Marshal(doc.Keys); string(keys) != `{"total":3,"added":null,"changed":null,"skipped":null}` {
+		t.Errorf("keys = %s", keys)
+	}
+
+	buf.Reset()
+	if err := writeExecutionSummary(&buf, summary, OutputText); err != nil {
+		t.Fatalf("writeExecutionSummary() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "Added, changed and unchanged keys: unknown") || strings.Contains(buf.String(), "Added keys:") {
+		t.Errorf("text summary does not mark the counts unknown:\n%s", buf.String())
+	}
+}
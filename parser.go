@@ -4,53 +4,327 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
-// loadYAMLFile loads a single YAML file and returns its content as a map
-func loadYAMLFile(filePath string) (map[string]interface{}, error) {
-	data, err := os.ReadFile(filePath)
+// loadSourceFile loads a file in the format of its extension or opts.Format, rendering it first
+// when it is a template
+func loadSourceFile(filePath string, opts LoadOptions) (*SourceFile, error) {
+	var data []byte
+	var err error
+
+	if isTemplateFile(filePath) {
+		data, err = renderTemplateFile(filePath, opts.Variables, opts.Strict)
+	} else if data, err = os.ReadFile(filePath); err != nil {
+		err = fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return formatLoaders[detectFormat(filePath, opts.Format)](filePath, data, opts)
+}
+
+// parseYAMLFile parses every document of a YAML file read from filePath. Documents are placed
+// below the prefix set by the last kv-prefix directive before or on them.
+func parseYAMLFile(filePath string, data []byte, opts LoadOptions) (*SourceFile, error) {
+	documents, err := decodeDocuments(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+		return nil, loadDiagnosticError(filePath, "parse YAML file", err)
+	}
+
+	if opts.SingleDocument && len(documents) > 1 {
+		return nil, loadDiagnosticError(filePath, "load", fmt.Errorf(
+			"line %d: file contains %d YAML documents but multi-document files are disabled",
+			documents[1].Content[0].Line, len(documents)))
+	}
+
+	source := &SourceFile{
+		Path: filePath,
+		Keys: make(map[string]KeyInfo),
+	}
+
+	roots := make([]*yaml.Node, len(documents))
+	for i, document := range documents {
+		roots[i] = document.Content[0]
+	}
+	if err := decryptDocuments(roots); err != nil {
+		return nil, loadDiagnosticError(filePath, "decrypt", err)
+	}
+
+	prefix := ""
+	for _, document := range documents {
+		if documentPrefixValue, ok := documentPrefix(document); ok {
+			prefix = documentPrefixValue
+		}
+		if isHeaderDocument(document) {
+			continue
+		}
+
+		if err := parseDocument(source, document.Content[0], prefix, opts.Strict); err != nil {
+			return nil, err
+		}
+	}
+
+	return source, nil
+}
+
+// parseDocument adds one document of a file below prefix to the source
+func parseDocument(source *SourceFile, root *yaml.Node, prefix string, strict bool) error {
+	includes := newIncludeResolver(source.Path)
+	if err := includes.resolve(root, source.Path); err != nil {
+		return loadDiagnosticError(source.Path, "resolve includes in", err)
+	}
+
+	fileValues := make(map[*yaml.Node]string)
+	if err := resolveFileValues(root, source.Path, includes.included, fileValues); err != nil {
+		return loadDiagnosticError(source.Path, "read file values of", err)
+	}
+
+	if err := stringifyMapKeys(root, prefix, source.Path, includes.included, strict); err != nil {
+		return loadDiagnosticError(source.Path, "load", err)
 	}
 
 	var content map[string]interface{}
-	if err := yaml.Unmarshal(data, &content); err != nil {
-		return nil, fmt.Errorf("failed to parse YAML file %s: %w", filePath, err)
+	if err := root.Decode(&content); err != nil {
+		return loadDiagnosticError(source.Path, "parse YAML file", err)
+	}
+
+	recorder := newKeyRecorder(includes.included, fileValues)
+	recorder.record(root, prefix, KeyInfo{File: source.Path})
+	if recorder.err != nil {
+		return loadDiagnosticError(source.Path, "load", recorder.err)
+	}
+
+	if source.Content == nil && prefix == "" {
+		source.Content = content
+	} else {
+		if source.Content == nil {
+			source.Content = make(map[string]interface{})
+		}
+		if conflict, ok := mergeDocument(source.Content, prefix, content); !ok {
+			return loadDiagnosticError(source.Path, "load", documentConflictError(conflict, source.Keys, recorder.keys))
+		}
 	}
 
-	return content, nil
+	for key, info := range recorder.keys {
+		source.Keys[key] = info
+	}
+	for key, format := range recorder.documents {
+		if source.Documents == nil {
+			source.Documents = make(map[string]string)
+		}
+		source.Documents[key] = format
+	}
+	for key, value := range recorder.untagged {
+		if source.Untagged == nil {
+			source.Untagged = make(map[string]interface{})
+		}
+		source.Untagged[key] = value
+	}
+	return nil
 }
 
-// loadAllYAMLFiles loads all YAML files and returns their contents with filenames
-func loadAllYAMLFiles(filePaths []string) ([]map[string]interface{}, []string, error) {
-	kvMaps := make([]map[string]interface{}, 0, len(filePaths))
-	filenames := make([]string, 0, len(filePaths))
+// keyRecorder records the source file and line of every key path in a document
+type keyRecorder struct {
+	keys      map[string]KeyInfo
+	documents map[string]string      // keys tagged !json or !yaml and their format
+	untagged  map[string]interface{} // values with tagged scalars, decoded without those tags
+	included  map[*yaml.Node]string  // nodes replaced by an !include and the file they came from
+	files     map[*yaml.Node]string  // values replaced by a !file and the file they were read from
+	err       error                  // first invalid tag found
+}
 
-	for _, filePath := range filePaths {
-		content, err := loadYAMLFile(filePath)
+func newKeyRecorder(included, files map[*yaml.Node]string) *keyRecorder {
+	return &keyRecorder{
+		keys:      make(map[string]KeyInfo),
+		documents: make(map[string]string),
+		untagged:  make(map[string]interface{}),
+		included:  included,
+		files:     files,
+	}
+}
+
+// record walks a YAML node and records the line of every key path below prefix,
+// whether it is marked sensitive by a !secret tag on itself or on a parent, and the
+// flags set by a !flags:N tag on itself or on a parent. parent holds what the node
+// inherits: the file it is defined in, sensitivity and flags.
+// Keys brought in through merge keys keep the line of their original definition,
+// and keys brought in through !include the file they are defined in.
+func (r *keyRecorder) record(node *yaml.Node, prefix string, parent KeyInfo) {
+	parent.Sensitive = parent.Sensitive || isSecretNode(node)
+	if includedPath, ok := r.included[node]; ok {
+		parent.File = includedPath
+	}
+	r.applyFlagsTag(node, &parent)
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		r.record(node.Alias, prefix, parent)
+	case yaml.MappingNode:
+		var merges []*yaml.Node
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			if keyNode.Tag == "!!merge" {
+				merges = append(merges, valueNode)
+				continue
+			}
+
+			fullKey := buildKey(prefix, keyNode.Value)
+			info := KeyInfo{
+				File:      parent.File,
+				Line:      keyNode.Line,
+				Sensitive: parent.Sensitive || isSecretNode(valueNode),
+				ValueFile: r.valueFile(valueNode),
+				Flags:     parent.Flags,
+				HasFlags:  parent.HasFlags,
+			}
+			r.applyFlagsTag(valueNode, &info)
+			r.keys[fullKey] = info
+			if format, ok := documentTagFormat(valueNode); ok {
+				r.documents[fullKey] = format
+			}
+			if value, ok := untaggedValue(valueNode); ok {
+				r.untagged[fullKey] = value
+			}
+			r.record(valueNode, fullKey, parent)
+		}
+
+		// Explicit keys take precedence over merged ones
+		for _, merge := range merges {
+			merged := newKeyRecorder(r.included, r.files)
+			merged.record(merge, prefix, parent)
+			if merged.err != nil && r.err == nil {
+				r.err = merged.err
+			}
+			for key, info := range merged.keys {
+				if _, exists := r.keys[key]; !exists {
+					r.keys[key] = info
+					if format, ok := merged.documents[key]; ok {
+						r.documents[key] = format
+					}
+					if value, ok := merged.untagged[key]; ok {
+						r.untagged[key] = value
+					}
+				}
+			}
+		}
+	case yaml.SequenceNode:
+		// Sequences of merge targets: <<: [*a, *b]
+		for _, item := range node.Content {
+			if item.Kind == yaml.AliasNode || item.Kind == yaml.MappingNode {
+				r.record(item, prefix, parent)
+			}
+		}
+	}
+}
+
+// applyFlagsTag sets the flags of info from a !flags:N tag on node, remembering the first invalid tag
+func (r *keyRecorder) applyFlagsTag(node *yaml.Node, info *KeyInfo) {
+	flags, ok, err := flagsTag(node)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	if ok {
+		info.Flags = flags
+		info.HasFlags = true
+	}
+}
+
+// untaggedValue decodes a scalar or list whose scalars carry a tag of this tool, like !secret or
+// !flags:N, as if those tags were not there. Such values load as strings, so this is the value the
+// YAML was written with: !secret 8080 is the integer 8080, while !secret "8080" stays a string.
+func untaggedValue(node *yaml.Node) (interface{}, bool) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.MappingNode || !hasLocalScalarTag(node) {
+		return nil, false
+	}
+
+	var value interface{}
+	if err := withoutLocalScalarTags(node).Decode(&value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// hasLocalScalarTag reports whether node is, or contains, a scalar with a "!name" tag
+func hasLocalScalarTag(node *yaml.Node) bool {
+	if node.Kind == yaml.AliasNode {
+		return hasLocalScalarTag(node.Alias)
+	}
+	if node.Kind == yaml.ScalarNode {
+		return strings.HasPrefix(node.Tag, "!") && !strings.HasPrefix(node.Tag, "!!")
+	}
+
+	for _, child := range node.Content {
+		if hasLocalScalarTag(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutLocalScalarTags returns a copy of node in which the "!name" tags of scalars are removed,
+// so that they are resolved from their text and style again
+func withoutLocalScalarTags(node *yaml.Node) *yaml.Node {
+	copied := *node
+	if copied.Alias != nil {
+		copied.Alias = withoutLocalScalarTags(copied.Alias)
+	}
+	if copied.Kind == yaml.ScalarNode && strings.HasPrefix(copied.Tag, "!") && !strings.HasPrefix(copied.Tag, "!!") {
+		copied.Tag = ""
+	}
+
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = withoutLocalScalarTags(child)
+	}
+	return &copied
+}
+
+// valueFile returns the file a value was read from with !file, following aliases
+func (r *keyRecorder) valueFile(node *yaml.Node) string {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return r.files[node]
+}
+
+// loadAllSourceFiles loads the files of all entries in order
+func loadAllSourceFiles(entries []FileEntry, opts LoadOptions) ([]*SourceFile, error) {
+	sources := make([]*SourceFile, 0, len(entries))
+
+	for _, entry := range entries {
+		entryOpts := opts
+		entryOpts.Format = entry.Format
+
+		source, err := loadSourceFile(entry.Path, entryOpts)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
-		kvMaps = append(kvMaps, content)
-		filenames = append(filenames, filepath.Base(filePath))
+		sources = append(sources, source)
 	}
 
-	return kvMaps, filenames, nil
+	return sources, nil
 }
 
-// flattenKVPairs converts nested map structure to flat key-value pairs
+// flattenKVPairs converts nested map structure to flat key-value pairs, visiting keys in sorted order
+// so that the result is the same on every run
 func flattenKVPairs(data map[string]interface{}, prefix string) []KVPair {
 	pairs := make([]KVPair, 0) // 空のスライスを初期化（nilではない）
 
-	for key, value := range data {
+	for _, key := range sortedKeys(data) {
 		fullKey := buildKey(prefix, key)
-		pairs = append(pairs, processValue(fullKey, value)...)
+		pairs = append(pairs, processValue(fullKey, data[key])...)
 	}
 
 	return pairs
@@ -76,29 +350,50 @@ func processValue(key string, value interface{}) []KVPair {
 	}
 }
 
-// processInterfaceMap converts map[interface{}]interface{} and processes it
+// processInterfaceMap converts map[interface{}]interface{} and processes it. Keys that are not
+// strings are converted to text rather than dropped.
 func processInterfaceMap(key string, m map[interface{}]interface{}) []KVPair {
 	convertedMap := make(map[string]interface{})
 	for k, v := range m {
-		if strKey, ok := k.(string); ok {
-			convertedMap[strKey] = v
-		}
+		convertedMap[mapKeyString(k)] = v
 	}
 	return flattenKVPairs(convertedMap, key)
 }
 
-// collectAllKVPairs collects all KV pairs from multiple YAML files
-func collectAllKVPairs(kvMaps []map[string]interface{}) []KVPair {
+// collectAllKVPairs collects all KV pairs from the loaded files, annotated with where each key is defined.
+// Pairs are sorted by key, and pairs with the same key keep the order of their files, so batches,
+// -dry-run and -export output are stable across runs.
+func collectAllKVPairs(sources []*SourceFile) []KVPair {
 	var allPairs []KVPair
 
-	for _, kvMap := range kvMaps {
-		pairs := flattenKVPairs(kvMap, "")
+	for _, source := range sources {
+		pairs := flattenKVPairs(source.Content, "")
+		for i := range pairs {
+			info := source.keyInfo(pairs[i].Key)
+			pairs[i].File = info.File
+			pairs[i].Line = info.Line
+			pairs[i].Sensitive = info.Sensitive
+			pairs[i].ValueFile = info.ValueFile
+			pairs[i].Flags = info.Flags
+		}
 		allPairs = append(allPairs, pairs...)
 	}
 
+	sort.SliceStable(allPairs, func(i, j int) bool {
+		return allPairs[i].Key < allPairs[j].Key
+	})
+
 	return allPairs
 }
 
+// keyInfo returns where a key of the file is defined, falling back to the file itself
+func (s *SourceFile) keyInfo(key string) KeyInfo {
+	if info, ok := s.Keys[key]; ok {
+		return info
+	}
+	return KeyInfo{File: s.Path}
+}
+
 // encodeValue encodes a string value to base64
 func encodeValue(value string) string {
 	return base64.StdEncoding.EncodeToString([]byte(value))
@@ -114,6 +409,7 @@ func createTransactionOps(pairs []KVPair) []TxnOp {
 				Verb:  "set",
 				Key:   pair.Key,
 				Value: encodeValue(pair.Value),
+				Flags: pair.Flags,
 			},
 		}
 	}
@@ -144,7 +440,16 @@ func formatKVPairsForDisplay(pairs []KVPair) string {
 
 	for _, pair := range pairs {
 		sb.WriteString(fmt.Sprintf("Key:   %s\n", pair.Key))
-		sb.WriteString(fmt.Sprintf("Value: %s\n", pair.Value))
+		sb.WriteString(fmt.Sprintf("Value: %s\n", displayValue(pair.Value, pair.Sensitive)))
+		if pair.ValueFile != "" {
+			sb.WriteString(fmt.Sprintf("File:  %s\n", pair.ValueFile))
+		}
+		if pair.Template != "" {
+			sb.WriteString(fmt.Sprintf("From:  %s\n", displayValue(pair.Template, pair.Sensitive)))
+		}
+		if pair.Flags != 0 {
+			sb.WriteString(fmt.Sprintf("Flags: %d\n", pair.Flags))
+		}
 		sb.WriteString(strings.Repeat("-", 60) + "\n")
 	}
 
@@ -154,20 +459,21 @@ func formatKVPairsForDisplay(pairs []KVPair) string {
 
 // exportToJSON exports KV pairs in Consul JSON format to stdout
 func exportToJSON(pairs []KVPair) error {
-	type consulKV struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
-	}
+	return writeConsulJSON(os.Stdout, pairs)
+}
 
-	kvData := make([]consulKV, len(pairs))
+// writeConsulJSON writes KV pairs in Consul JSON format to w
+func writeConsulJSON(w io.Writer, pairs []KVPair) error {
+	kvData := make([]ExportedKV, len(pairs))
 	for i, pair := range pairs {
-		kvData[i] = consulKV{
+		kvData[i] = ExportedKV{
 			Key:   pair.Key,
+			Flags: pair.Flags,
 			Value: encodeValue(pair.Value),
 		}
 	}
 
-	encoder := json.NewEncoder(os.Stdout)
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "\t")
 	if err := encoder.Encode(kvData); err != nil {
 		return fmt.Errorf("failed to encode JSON: %w", err)
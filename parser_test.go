@@ -2,8 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
-	"sort"
 	"testing"
 )
 
@@ -54,8 +55,8 @@ func TestFlattenKVPairs(t *testing.T) {
 			prefix: "",
 			expected: []KVPair{
 				{Key: "flat", Value: "value"},
-				{Key: "nested/level1/level2", Value: "deep_value"},
 				{Key: "nested/another", Value: "value2"},
+				{Key: "nested/level1/level2", Value: "deep_value"},
 			},
 		},
 		{
@@ -77,9 +78,9 @@ func TestFlattenKVPairs(t *testing.T) {
 			},
 			prefix: "",
 			expected: []KVPair{
-				{Key: "int", Value: "123"},
-				{Key: "float", Value: "45.67"},
 				{Key: "bool", Value: "true"},
+				{Key: "float", Value: "45.67"},
+				{Key: "int", Value: "123"},
 			},
 		},
 		{
@@ -104,16 +105,8 @@ func TestFlattenKVPairs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			// The order is part of the result: it decides batches and the order of -export output
 			result := flattenKVPairs(tt.input, tt.prefix)
-
-			// Sort both slices for consistent comparison
-			sort.Slice(result, func(i, j int) bool {
-				return result[i].Key < result[j].Key
-			})
-			sort.Slice(tt.expected, func(i, j int) bool {
-				return tt.expected[i].Key < tt.expected[j].Key
-			})
-
 			if !reflect.DeepEqual(result, tt.expected) {
 				t.Errorf("flattenKVPairs() = %v, want %v", result, tt.expected)
 			}
@@ -121,6 +114,41 @@ func TestFlattenKVPairs(t *testing.T) {
 	}
 }
 
+func TestCollectAllKVPairsOrder(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"b.yaml": "zeta: 1\napp:\n  port: 80\n  name: b\n",
+		"a.yaml": "app:\n  name: a\n  db-host: x\nalpha: 2\n",
+	})
+	sources, err := loadAllSourceFiles(fileEntries(filepath.Join(dir, "b.yaml"), filepath.Join(dir, "a.yaml")), LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadAllSourceFiles() error = %v", err)
+	}
+
+	want := []string{
+		"alpha",
+		"app/db-host",
+		"app/name b.yaml",
+		"app/name a.yaml",
+		"app/port",
+		"zeta",
+	}
+
+	// Map iteration order is random, so the same order on repeated runs is what matters
+	for run := 0; run < 20; run++ {
+		var got []string
+		for _, pair := range collectAllKVPairs(sources) {
+			entry := pair.Key
+			if pair.Key == "app/name" {
+				entry += " " + filepath.Base(pair.File)
+			}
+			got = append(got, entry)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: collectAllKVPairs() keys = %q, want %q", run, got, want)
+		}
+	}
+}
+
 func TestChunkOps(t *testing.T) {
 	// Create test operations
 	ops := make([]TxnOp, 150)
@@ -227,3 +255,47 @@ func TestEncodeValue(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadYAMLFileKeyLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	content := `# comment
+defaults: &defaults
+  timeout: 30s
+  retries: 3
+
+app:
+  <<: *defaults
+  retries: 5
+  server:
+    port: 8080
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadSourceFile(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	expected := map[string]int{
+		"defaults/timeout": 3,
+		"app":              6,
+		"app/timeout":      3,
+		"app/retries":      8,
+		"app/server/port":  10,
+	}
+
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	for key, line := range expected {
+		if info := source.Keys[key]; info.Line != line || info.File != path {
+			t.Errorf("Keys[%q] = %+v, want line %d in %s", key, info, line, path)
+		}
+	}
+
+	for _, pair := range pairs {
+		if pair.File != path || pair.Line != source.Keys[pair.Key].Line {
+			t.Errorf("pair %s has source %s:%d, want %s:%d", pair.Key, pair.File, pair.Line, path, source.Keys[pair.Key].Line)
+		}
+	}
+}
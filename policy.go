@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkKeyPrefixes reports every key the environment may not write: keys under a denied prefix,
+// and keys outside all allowed prefixes when allowed prefixes are set. Denied prefixes take
+// precedence over allowed ones.
+func checkKeyPrefixes(pairs []KVPair, allowed, denied []string) error {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil
+	}
+
+	var diagnostics []Diagnostic
+	for _, pair := range pairs {
+		problem := prefixProblem(pair.Key, allowed, denied)
+		if problem == "" {
+			continue
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Category: CategoryPolicy,
+			File:     pair.File,
+			Line:     pair.Line,
+			Key:      pair.Key,
+			Message:  fmt.Sprintf("%q: %s", pair.Key, problem),
+		})
+	}
+
+	return diagnosticListError("%d keys outside the prefixes this environment may write", diagnostics)
+}
+
+// prefixProblem returns why key may not be written, or an empty string when it may
+func prefixProblem(key string, allowed, denied []string) string {
+	for _, prefix := range denied {
+		if hasKeyPrefix(key, prefix) {
+			return fmt.Sprintf("key is under denied prefix %q", prefix)
+		}
+	}
+
+	if len(allowed) == 0 {
+		return ""
+	}
+	for _, prefix := range allowed {
+		if hasKeyPrefix(key, prefix) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("key is not under any allowed prefix (%s)", strings.Join(allowed, ", "))
+}
+
+// hasKeyPrefix reports whether key is prefix itself or below it. Prefixes match whole segments,
+// so "app" matches "app/name" but not "application/name", and "/" matches every key.
+func hasKeyPrefix(key, prefix string) bool {
+	prefix = strings.Trim(prefix, "/")
+	return prefix == "" || key == prefix || strings.HasPrefix(key, prefix+"/")
+}
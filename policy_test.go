@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPrefixProblem(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		allowed []string
+		denied  []string
+		want    string
+	}{
+		{name: "no rules", key: "anything/goes"},
+		{name: "allowed", key: "team-a/app/port", allowed: []string{"team-a", "shared/"}},
+		{name: "allowed prefix itself", key: "shared", allowed: []string{"team-a", "shared/"}},
+		{name: "allowed with slashes", key: "shared/x", allowed: []string{"/shared/"}},
+		{name: "whole store", key: "x/y", allowed: []string{"/"}},
+		{
+			name:    "not allowed",
+			key:     "team-b/app/port",
+			allowed: []string{"team-a", "shared"},
+			want:    "key is not under any allowed prefix (team-a, shared)",
+		},
+		{
+			name:    "prefix matches whole segments",
+			key:     "team-ab/port",
+			allowed: []string{"team-a"},
+			want:    "key is not under any allowed prefix (team-a)",
+		},
+		{
+			name:   "denied",
+			key:    "team-b/app/port",
+			denied: []string{"team-b"},
+			want:   `key is under denied prefix "team-b"`,
+		},
+		{
+			name:    "denied below an allowed prefix",
+			key:     "shared/secrets/db",
+			allowed: []string{"shared"},
+			denied:  []string{"shared/secrets"},
+			want:    `key is under denied prefix "shared/secrets"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixProblem(tt.key, tt.allowed, tt.denied); got != tt.want {
+				t.Errorf("prefixProblem(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckKeyPrefixes(t *testing.T) {
+	pairs := []KVPair{
+		{Key: "team-a/name", File: "a.yaml", Line: 1},
+		{Key: "team-b/name", File: "a.yaml", Line: 4},
+		{Key: "shared/secrets/db", File: "shared.yaml", Line: 2},
+	}
+
+	err := checkKeyPrefixes(pairs, []string{"team-a", "shared"}, []string{"shared/secrets"})
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) {
+		t.Fatalf("checkKeyPrefixes() error = %v, want a DiagnosticError", err)
+	}
+	if len(diagErr.Diagnostics) != 2 {
+		t.Fatalf("diagnostics = %+v, want 2", diagErr.Diagnostics)
+	}
+	for i, want := range []string{"a.yaml:4", "shared.yaml:2"} {
+		diag := diagErr.Diagnostics[i]
+		if formatLocation(diag.File, diag.Line) != want || diag.Category != CategoryPolicy {
+			t.Errorf("diagnostic %d = %+v, want %s", i, diag, want)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "2 keys outside the prefixes this environment may write:") {
+		t.Errorf("error = %v", err)
+	}
+
+	if err := checkKeyPrefixes(pairs[:1], []string{"team-a"}, nil); err != nil {
+		t.Errorf("checkKeyPrefixes() with allowed keys error = %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GeneratedFile is a YAML file produced from an existing Consul key space
+type GeneratedFile struct {
+	Name    string
+	Content []byte
+}
+
+// runPull reads a prefix from Consul and writes it as nested YAML files
+func runPull(ctx context.Context, opts Options) error {
+	prefix := strings.Trim(opts.Pull, "/")
+	client := NewConsulClient(opts.ConsulAddr, opts.Datacenter)
+
+	slog.Debug("reading keys from Consul", "prefix", prefix)
+
+	entries, err := client.listKeys(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to read keys under '%s': %w", prefix, err)
+	}
+
+	pairs, err := decodeKVData(entries)
+	if err != nil {
+		return err
+	}
+	pairs = keysUnderPrefix(pairs, prefix)
+
+	files, err := generateYAMLFiles(pairs, prefix, opts.Split)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("writing generated files", "keys", len(pairs), "files", len(files), "dir", opts.PullDir)
+
+	paths, err := writeGeneratedFiles(files, opts.PullDir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		slog.Info("wrote file", "file", path)
+	}
+
+	if opts.Environment != "" {
+		fmt.Print(formatEnvironmentEntry(opts.Environment, environmentFilePaths(opts.ConfigFile, paths)))
+	}
+
+	return nil
+}
+
+// generateYAMLFiles converts flat KV pairs into nested YAML documents, either as one
+// file or as one file per top-level key
+func generateYAMLFiles(pairs []KVPair, prefix string, split bool) ([]GeneratedFile, error) {
+	tree, err := unflattenKVPairs(pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tree) == 0 {
+		return nil, fmt.Errorf("no keys found under '%s'", prefix)
+	}
+
+	if !split {
+		content, err := marshalTree(tree)
+		if err != nil {
+			return nil, err
+		}
+		return []GeneratedFile{{Name: pullFileName(prefix) + ".yaml", Content: content}}, nil
+	}
+
+	files := make([]GeneratedFile, 0, len(tree))
+	for _, key := range sortedKeys(tree) {
+		content, err := marshalTree(map[string]interface{}{key: tree[key]})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, GeneratedFile{Name: pullFileName(key) + ".yaml", Content: content})
+	}
+
+	return files, nil
+}
+
+// unflattenKVPairs is the inverse of flattenKVPairs: it rebuilds the nested map from slash separated keys
+func unflattenKVPairs(pairs []KVPair) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	var conflicts []string
+
+	for _, pair := range pairs {
+		// Keys ending in "/" are folder placeholders without a value of their own
+		if strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+
+		if strings.HasPrefix(pair.Key, "/") {
+			conflicts = append(conflicts, fmt.Sprintf("key '%s' starts with '/' and cannot be represented in YAML", pair.Key))
+			continue
+		}
+
+		if err := insertKey(tree, strings.Split(pair.Key, "/"), pair); err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("key '%s': %v", pair.Key, err))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, fmt.Errorf("cannot convert key space to YAML:\n  %s", strings.Join(conflicts, "\n  "))
+	}
+
+	return tree, nil
+}
+
+// insertKey stores pair at the path described by segments, creating intermediate maps
+func insertKey(tree map[string]interface{}, segments []string, pair KVPair) error {
+	current := tree
+
+	for i, segment := range segments[:len(segments)-1] {
+		switch next := current[segment].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			current[segment] = child
+			current = child
+		case map[string]interface{}:
+			current = next
+		default:
+			return fmt.Errorf("'%s' already holds a value", strings.Join(segments[:i+1], "/"))
+		}
+	}
+
+	last := segments[len(segments)-1]
+	if _, exists := current[last]; exists {
+		return fmt.Errorf("'%s' is also a parent of other keys", strings.Join(segments, "/"))
+	}
+	current[last] = pair
+
+	return nil
+}
+
+// marshalTree renders a nested map as YAML with sorted keys
+func marshalTree(tree map[string]interface{}) ([]byte, error) {
+	var sb strings.Builder
+	encoder := yaml.NewEncoder(&sb)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(buildYAMLNode(tree)); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+
+	return []byte(sb.String()), nil
+}
+
+// buildYAMLNode converts a tree produced by unflattenKVPairs into a YAML node
+func buildYAMLNode(value interface{}) *yaml.Node {
+	tree, ok := value.(map[string]interface{})
+	if !ok {
+		return buildLeafNode(value.(KVPair))
+	}
+
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range sortedKeys(tree) {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			buildYAMLNode(tree[key]),
+		)
+	}
+
+	return node
+}
+
+// buildLeafNode returns the node of a single key, tagged !flags:N when the key has flags
+func buildLeafNode(pair KVPair) *yaml.Node {
+	node := buildScalarNode(pair.Value)
+	if pair.Flags == 0 {
+		return node
+	}
+
+	if node.Tag == "!!binary" {
+		slog.Warn("flags of a binary value cannot be written as a tag and are dropped", "key", pair.Key, "flags", pair.Flags)
+		return node
+	}
+	node.Tag = FlagsTagPrefix + strconv.FormatUint(pair.Flags, 10)
+	return node
+}
+
+// buildScalarNode returns a node that loads back to exactly the given value.
+// Numbers and booleans are written plain when they survive the round trip
+// through flattenKVPairs unchanged, everything else is written as a string.
+func buildScalarNode(value string) *yaml.Node {
+	if !utf8.ValidString(value) {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!binary", Value: base64.StdEncoding.EncodeToString([]byte(value))}
+	}
+
+	var decoded interface{}
+	if err := yaml.Unmarshal([]byte(value), &decoded); err == nil {
+		switch decoded.(type) {
+		case int, float64, bool:
+			if fmt.Sprintf("%v", decoded) == value {
+				return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+			}
+		}
+	}
+
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pullFileName derives a file name from a key prefix
+func pullFileName(prefix string) string {
+	name := strings.Trim(prefix, "/")
+	if name == "" {
+		return "consul-kv"
+	}
+	return strings.ReplaceAll(name, "/", "-")
+}
+
+// writeGeneratedFiles writes files into dir without overwriting existing ones and returns their paths
+func writeGeneratedFiles(files []GeneratedFile, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name)
+
+		out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return paths, fmt.Errorf("failed to create %s: %w", path, err)
+		}
+
+		_, err = out.Write(file.Content)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return paths, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// environmentFilePaths converts written paths into entries as resolveFilePaths expects them,
+// i.e. relative to the kv-files directory next to the config file when possible
+func environmentFilePaths(configPath string, paths []string) []string {
+	kvDir, err := filepath.Abs(filepath.Join(filepath.Dir(configPath), "kv-files"))
+	if err != nil {
+		return paths
+	}
+
+	entries := make([]string, len(paths))
+	for i, path := range paths {
+		entries[i] = path
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(kvDir, absPath)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			entries[i] = absPath
+			continue
+		}
+		entries[i] = filepath.ToSlash(rel)
+	}
+
+	return entries
+}
+
+// formatEnvironmentEntry formats an environments.yaml entry listing the given files
+func formatEnvironmentEntry(environment string, files []string) string {
+	var sb strings.Builder
+	sb.WriteString("# Add to environments.yaml:\n")
+	sb.WriteString(fmt.Sprintf("%s:\n", environment))
+	for _, file := range files {
+		sb.WriteString(fmt.Sprintf("  - %s\n", file))
+	}
+	return sb.String()
+}
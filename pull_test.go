@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGenerateYAMLFilesRoundTrip(t *testing.T) {
+	pairs := []KVPair{
+		{Key: "app/name", Value: "myapp"},
+		{Key: "app/server/port", Value: "8080"},
+		{Key: "app/server/ratio", Value: "1.50"},
+		{Key: "app/debug", Value: "true"},
+		{Key: "app/quoted", Value: "null"},
+		{Key: "app/empty", Value: ""},
+		{Key: "app/script", Value: "#!/bin/sh\necho hello\n"},
+		{Key: "app/binary", Value: "\xff\xfe\x00"},
+		{Key: "database/host", Value: "db.internal"},
+		{Key: "database/", Value: ""},
+	}
+
+	for _, split := range []bool{false, true} {
+		files, err := generateYAMLFiles(pairs, "", split)
+		if err != nil {
+			t.Fatalf("generateYAMLFiles(split=%v) error = %v", split, err)
+		}
+
+		wantFiles := 1
+		if split {
+			wantFiles = 2
+		}
+		if len(files) != wantFiles {
+			t.Fatalf("generateYAMLFiles(split=%v) returned %d files, want %d", split, len(files), wantFiles)
+		}
+
+		var result []KVPair
+		for _, file := range files {
+			var content map[string]interface{}
+			if err := yaml.Unmarshal(file.Content, &content); err != nil {
+				t.Fatalf("generated file %s is not valid YAML: %v\n%s", file.Name, err, file.Content)
+			}
+			result = append(result, flattenKVPairs(content, "")...)
+		}
+
+		// Folder placeholders are not represented in YAML
+		expected := append([]KVPair(nil), pairs[:len(pairs)-1]...)
+		sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+		sort.Slice(expected, func(i, j int) bool { return expected[i].Key < expected[j].Key })
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("round trip (split=%v) = %v, want %v", split, result, expected)
+		}
+	}
+}
+
+func TestRunPullIgnoresSiblingPrefixes(t *testing.T) {
+	_, server := newFakeConsul(t, map[string]string{
+		"app/name":         "myapp",
+		"app/server/port":  "8080",
+		"application/name": "unrelated",
+		"apps/list":        "unrelated",
+	})
+
+	for _, split := range []bool{false, true} {
+		dir := t.TempDir()
+		opts := Options{Pull: "app/", ConsulAddr: server.URL, Datacenter: DefaultDatacenter, PullDir: dir, Split: split}
+		if err := runPull(context.Background(), opts); err != nil {
+			t.Fatalf("runPull(split=%v) error = %v", split, err)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "app.yaml" {
+			t.Fatalf("runPull(split=%v) wrote %v, want only app.yaml", split, entries)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, "app.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "app:\n  name: myapp\n  server:\n    port: 8080\n"; string(content) != want {
+			t.Errorf("runPull(split=%v) wrote:\n%s\nwant:\n%s", split, content, want)
+		}
+	}
+}
+
+func TestGenerateYAMLFilesScalarStyle(t *testing.T) {
+	files, err := generateYAMLFiles([]KVPair{
+		{Key: "app/port", Value: "8080"},
+		{Key: "app/ratio", Value: "1.50"},
+	}, "app", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := string(files[0].Content)
+	if files[0].Name != "app.yaml" {
+		t.Errorf("file name = %s, want app.yaml", files[0].Name)
+	}
+	for _, want := range []string{"port: 8080\n", "ratio: \"1.50\"\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("generated YAML missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestUnflattenKVPairsConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs []KVPair
+		want  string
+	}{
+		{
+			name:  "value and children",
+			pairs: []KVPair{{Key: "app", Value: "x"}, {Key: "app/name", Value: "y"}},
+			want:  "'app' already holds a value",
+		},
+		{
+			name:  "children then value",
+			pairs: []KVPair{{Key: "app/name", Value: "y"}, {Key: "app", Value: "x"}},
+			want:  "'app' is also a parent of other keys",
+		},
+		{
+			name:  "leading slash",
+			pairs: []KVPair{{Key: "/app", Value: "x"}},
+			want:  "starts with '/'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := unflattenKVPairs(tt.pairs)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("unflattenKVPairs() error = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvironmentFilePaths(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "environments.yaml")
+	outside := filepath.Join(t.TempDir(), "app.yaml")
+
+	paths := []string{
+		filepath.Join(dir, "kv-files", "production", "app.yaml"),
+		outside,
+	}
+
+	expected := []string{"production/app.yaml", outside}
+	if result := environmentFilePaths(configPath, paths); !reflect.DeepEqual(result, expected) {
+		t.Errorf("environmentFilePaths() = %v, want %v", result, expected)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ReportJUnit  = "junit"
+	ReportGitHub = "github"
+)
+
+// Diagnostic categories
+const (
+	CategoryLoad          = "load"
+	CategoryDuplicate     = "duplicate"
+	CategoryRejected      = "rejected"
+	CategoryInterpolation = "interpolation"
+	CategoryValueSize     = "size"
+	CategoryInvalidKey    = "key"
+	CategorySchema        = "schema"
+	CategoryPolicy        = "policy"
+	CategoryError         = "error"
+)
+
+// reportFlags collects repeated -report flags
+type reportFlags []ReportSpec
+
+func (r *reportFlags) String() string {
+	specs := make([]string, len(*r))
+	for i, spec := range *r {
+		specs[i] = spec.Format
+		if spec.Path != "" {
+			specs[i] += "=" + spec.Path
+		}
+	}
+	return strings.Join(specs, ",")
+}
+
+func (r *reportFlags) Set(value string) error {
+	format, path, _ := strings.Cut(value, "=")
+
+	switch format {
+	case ReportJUnit:
+		if path == "" {
+			return fmt.Errorf("junit report requires a path, e.g. junit=report.xml")
+		}
+	case ReportGitHub:
+		if path != "" {
+			return fmt.Errorf("github report is written to the console and takes no path")
+		}
+	default:
+		return fmt.Errorf("unknown report format '%s' (supported: %s, %s)", format, ReportJUnit, ReportGitHub)
+	}
+
+	*r = append(*r, ReportSpec{Format: format, Path: path})
+	return nil
+}
+
+// DiagnosticError is an error made of individual problems that can be reported per file and line
+type DiagnosticError struct {
+	Message     string
+	Diagnostics []Diagnostic
+}
+
+func (e *DiagnosticError) Error() string {
+	return e.Message
+}
+
+// Fail records the error that ended the run
+func (r *RunReport) Fail(err error) {
+	if err == nil {
+		return
+	}
+
+	var diagErr *DiagnosticError
+	if errors.As(err, &diagErr) {
+		r.Diagnostics = append(r.Diagnostics, diagErr.Diagnostics...)
+		return
+	}
+
+	// Rejected operations are reported from the summary itself
+	if r.Summary != nil {
+		return
+	}
+
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{Category: CategoryError, Message: err.Error()})
+}
+
+// AllDiagnostics returns the recorded diagnostics followed by one per rejected transaction operation
+func (r *RunReport) AllDiagnostics() []Diagnostic {
+	diagnostics := append([]Diagnostic(nil), r.Diagnostics...)
+	if r.Summary == nil {
+		return diagnostics
+	}
+
+	for _, result := range r.Summary.Results {
+		for _, opErr := range result.OpErrors {
+			pair, ok := opErrorPair(result, opErr)
+			if !ok {
+				diagnostics = append(diagnostics, Diagnostic{
+					Category: CategoryRejected,
+					Message:  fmt.Sprintf("Batch %d operation %d rejected: %s", result.BatchIndex+1, opErr.OpIndex, opErr.What),
+				})
+				continue
+			}
+
+			diagnostics = append(diagnostics, Diagnostic{
+				Category: CategoryRejected,
+				File:     pair.File,
+				Line:     pair.Line,
+				Key:      pair.Key,
+				Message:  fmt.Sprintf("Consul rejected key %s: %s", pair.Key, opErr.What),
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// duplicateDiagnostics returns one diagnostic per definition of each duplicate key
+func duplicateDiagnostics(duplicates []DuplicateInfo) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, dup := range duplicates {
+		for i, file := range dup.Files {
+			others := make([]string, 0, len(dup.Files)-1)
+			for j, other := range dup.Files {
+				if i != j {
+					others = append(others, formatLocation(other.Filename, other.Line))
+				}
+			}
+
+			diagnostics = append(diagnostics, Diagnostic{
+				Category: CategoryDuplicate,
+				File:     file.Filename,
+				Line:     file.Line,
+				Key:      dup.Key,
+				Message:  fmt.Sprintf("Duplicate key %s, also defined in %s", dup.Key, strings.Join(others, ", ")),
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// errorLine finds the line in YAML ("line 3") and template ("template: app.yaml.tmpl:3:") errors
+var errorLine = regexp.MustCompile(`line (\d+)|^template: [^:]+:(\d+)`)
+
+// loadDiagnosticError wraps an error raised while loading a file so it is reported against that file.
+// action describes the step that failed, e.g. "parse YAML file".
+func loadDiagnosticError(filePath, action string, err error) error {
+	line := 0
+	if match := errorLine.FindStringSubmatch(err.Error()); match != nil {
+		line, _ = strconv.Atoi(match[1] + match[2])
+	}
+
+	message := fmt.Sprintf("failed to %s %s: %v", action, filePath, err)
+	return &DiagnosticError{
+		Message: message,
+		Diagnostics: []Diagnostic{{
+			Category: CategoryLoad,
+			File:     filePath,
+			Line:     line,
+			Message:  err.Error(),
+		}},
+	}
+}
+
+// diagnosticListError returns an error that lists every diagnostic at its location below a header
+// like "%d invalid keys", or nil when there are none
+func diagnosticListError(header string, diagnostics []Diagnostic) error {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(header+":", len(diagnostics)))
+	for _, diag := range diagnostics {
+		sb.WriteString(fmt.Sprintf("\n  %s: %s", formatLocation(diag.File, diag.Line), diag.Message))
+	}
+	return &DiagnosticError{Message: sb.String(), Diagnostics: diagnostics}
+}
+
+// writeReports renders the run report in every requested format
+func writeReports(specs []ReportSpec, report *RunReport, console io.Writer) error {
+	for _, spec := range specs {
+		switch spec.Format {
+		case ReportJUnit:
+			if err := writeJUnitFile(spec.Path, report); err != nil {
+				return err
+			}
+		case ReportGitHub:
+			if _, err := io.WriteString(console, formatGitHubAnnotations(report)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatGitHubAnnotations renders every diagnostic as a GitHub Actions ::error workflow command
+func formatGitHubAnnotations(report *RunReport) string {
+	var sb strings.Builder
+
+	for _, diag := range report.AllDiagnostics() {
+		var props []string
+		if diag.File != "" {
+			props = append(props, "file="+escapeAnnotationProperty(diag.File))
+		}
+		if diag.Line > 0 {
+			props = append(props, fmt.Sprintf("line=%d", diag.Line))
+		}
+		props = append(props, "title="+escapeAnnotationProperty(annotationTitle(diag.Category)))
+
+		sb.WriteString(fmt.Sprintf("::error %s::%s\n", strings.Join(props, ","), escapeAnnotationData(diag.Message)))
+	}
+
+	return sb.String()
+}
+
+// annotationTitle returns the annotation title for a diagnostic category
+func annotationTitle(category string) string {
+	switch category {
+	case CategoryLoad:
+		return "Invalid file"
+	case CategoryDuplicate:
+		return "Duplicate key"
+	case CategoryRejected:
+		return "Rejected by Consul"
+	case CategoryInterpolation:
+		return "Unresolved reference"
+	case CategoryValueSize:
+		return "Value too large"
+	case CategoryInvalidKey:
+		return "Invalid key"
+	case CategorySchema:
+		return "Schema violation"
+	case CategoryPolicy:
+		return "Key not allowed"
+	default:
+		return "consul-kv-sync"
+	}
+}
+
+func escapeAnnotationData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+func escapeAnnotationProperty(s string) string {
+	s = escapeAnnotationData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
+
+// JUnit XML document types
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitFile writes the run report as JUnit XML to path
+func writeJUnitFile(path string, report *RunReport) error {
+	data, err := xml.MarshalIndent(buildJUnitReport(report), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %w", err)
+	}
+
+	data = append([]byte(xml.Header), data...)
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+
+	return nil
+}
+
+// buildJUnitReport turns the run report into test suites: one test case per file and one per batch
+func buildJUnitReport(report *RunReport) junitTestSuites {
+	byFile := make(map[string][]Diagnostic)
+	var general []Diagnostic
+
+	for _, diag := range report.AllDiagnostics() {
+		if diag.Category == CategoryRejected && report.Summary != nil {
+			// Rejected operations are reported on their batch
+			continue
+		}
+		if diag.File == "" {
+			general = append(general, diag)
+			continue
+		}
+		byFile[diag.File] = append(byFile[diag.File], diag)
+	}
+
+	files := append([]string(nil), report.Files...)
+	for file := range byFile {
+		if !containsString(files, file) {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	fileSuite := junitTestSuite{Name: "files"}
+	for _, file := range files {
+		fileSuite.TestCases = append(fileSuite.TestCases, junitTestCase{
+			Name:      file,
+			ClassName: "consul-kv-sync.files",
+			Failure:   diagnosticsFailure(byFile[file]),
+		})
+	}
+	if len(general) > 0 {
+		fileSuite.TestCases = append(fileSuite.TestCases, junitTestCase{
+			Name:      "run",
+			ClassName: "consul-kv-sync",
+			Failure:   diagnosticsFailure(general),
+		})
+	}
+
+	suites := []junitTestSuite{fileSuite}
+
+	if report.Summary != nil {
+		batchSuite := junitTestSuite{Name: "batches", SystemOut: formatExecutionSummary(report.Summary)}
+		for _, result := range report.Summary.Results {
+			testCase := junitTestCase{
+				Name:      fmt.Sprintf("batch %d", result.BatchIndex+1),
+				ClassName: "consul-kv-sync.sync",
+			}
+			if !result.Success {
+				var sb strings.Builder
+				writeOperationErrors(&sb, result)
+				testCase.Failure = &junitFailure{
+					Message: fmt.Sprintf("%v", result.Error),
+					Type:    CategoryRejected,
+					Text:    sb.String(),
+				}
+			}
+			batchSuite.TestCases = append(batchSuite.TestCases, testCase)
+		}
+		suites = append(suites, batchSuite)
+	}
+
+	doc := junitTestSuites{Name: "consul-kv-sync"}
+	for i := range suites {
+		suites[i].Tests = len(suites[i].TestCases)
+		for _, testCase := range suites[i].TestCases {
+			if testCase.Failure != nil {
+				suites[i].Failures++
+			}
+		}
+		doc.Tests += suites[i].Tests
+		doc.Failures += suites[i].Failures
+	}
+	doc.Suites = suites
+
+	return doc
+}
+
+// diagnosticsFailure combines diagnostics into a single JUnit failure, or nil when there are none
+func diagnosticsFailure(diagnostics []Diagnostic) *junitFailure {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	for _, diag := range diagnostics {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", formatLocation(diag.File, diag.Line), diag.Message))
+	}
+
+	message := diagnostics[0].Message
+	if len(diagnostics) > 1 {
+		message = fmt.Sprintf("%d problems", len(diagnostics))
+	}
+
+	return &junitFailure{Message: message, Type: diagnostics[0].Category, Text: sb.String()}
+}
+
+// containsString reports whether s is in list
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportFlagsSet(t *testing.T) {
+	var flags reportFlags
+	for _, value := range []string{"junit=out/report.xml", "github"} {
+		if err := flags.Set(value); err != nil {
+			t.Fatalf("Set(%q) error = %v", value, err)
+		}
+	}
+
+	if flags.String() != "junit=out/report.xml,github" {
+		t.Errorf("String() = %q", flags.String())
+	}
+
+	for _, value := range []string{"junit", "github=x", "tap=out.tap"} {
+		if err := flags.Set(value); err == nil {
+			t.Errorf("Set(%q) expected error", value)
+		}
+	}
+}
+
+func TestFormatGitHubAnnotations(t *testing.T) {
+	duplicates := []DuplicateInfo{{
+		Key: "app/name",
+		Files: []FileSource{
+			{Filename: "kv-files/a.yaml", Line: 3, Value: "x"},
+			{Filename: "kv-files/b.yaml", Line: 5, Value: "y"},
+		},
+	}}
+
+	report := &RunReport{}
+	report.Fail(&DiagnosticError{Message: "duplicate keys detected", Diagnostics: duplicateDiagnostics(duplicates)})
+	report.Fail(nil)
+
+	expected := "::error file=kv-files/a.yaml,line=3,title=Duplicate key::Duplicate key app/name, also defined in kv-files/b.yaml:5\n" +
+		"::error file=kv-files/b.yaml,line=5,title=Duplicate key::Duplicate key app/name, also defined in kv-files/a.yaml:3\n"
+
+	if result := formatGitHubAnnotations(report); result != expected {
+		t.Errorf("formatGitHubAnnotations() =\n%s\nwant\n%s", result, expected)
+	}
+}
+
+func TestFormatGitHubAnnotationsEscaping(t *testing.T) {
+	report := &RunReport{}
+	report.Fail(errors.New("100% broken\nsecond line"))
+
+	expected := "::error title=consul-kv-sync::100%25 broken%0Asecond line\n"
+	if result := formatGitHubAnnotations(report); result != expected {
+		t.Errorf("formatGitHubAnnotations() = %q, want %q", result, expected)
+	}
+}
+
+func TestLoadDiagnosticErrorLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.yaml")
+	if err := os.WriteFile(path, []byte("app:\n  name: x\n bad: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadSourceFile(path, LoadOptions{})
+
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) {
+		t.Fatalf("loadSourceFile() error = %v, want DiagnosticError", err)
+	}
+	if diag := diagErr.Diagnostics[0]; diag.File != path || diag.Line == 0 {
+		t.Errorf("diagnostic = %+v, want file %s with a line", diag, path)
+	}
+}
+
+func TestDiagnosticListError(t *testing.T) {
+	if err := diagnosticListError("%d invalid keys", nil); err != nil {
+		t.Errorf("diagnosticListError() without diagnostics = %v, want nil", err)
+	}
+
+	diagnostics := []Diagnostic{
+		{File: "app.yaml", Line: 3, Key: "a//b", Message: "first"},
+		{File: "export.json", Key: "/lead", Message: "second"},
+	}
+	err := diagnosticListError("%d invalid keys", diagnostics)
+
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) || len(diagErr.Diagnostics) != 2 {
+		t.Fatalf("diagnosticListError() = %v, want DiagnosticError with 2 diagnostics", err)
+	}
+	if expected := "2 invalid keys:\n  app.yaml:3: first\n  export.json: second"; err.Error() != expected {
+		t.Errorf("message = %q, want %q", err.Error(), expected)
+	}
+}
+
+func TestWriteJUnitFile(t *testing.T) {
+	report := &RunReport{
+		Files: []string{"kv-files/a.yaml", "kv-files/b.yaml"},
+		Summary: &ExecutionSummary{
+			TotalBatches:   2,
+			SuccessBatches: 1,
+			FailedBatches:  1,
+			Results: []BatchResult{
+				{BatchIndex: 0, Success: true},
+				{
+					BatchIndex: 1,
+					Error:      errors.New("transaction rolled back with 1 errors"),
+					Pairs:      []KVPair{{Key: "app/port", Value: "x", File: "kv-files/b.yaml", Line: 4}},
+					OpErrors:   []TxnError{{OpIndex: 0, What: "invalid"}},
+				},
+			},
+		},
+	}
+	report.Diagnostics = append(report.Diagnostics, Diagnostic{Category: CategoryDuplicate, File: "kv-files/a.yaml", Line: 2, Message: "dup"})
+
+	path := filepath.Join(t.TempDir(), "report.xml")
+	if err := writeJUnitFile(path, report); err != nil {
+		t.Fatalf("writeJUnitFile() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc junitTestSuites
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("report is not valid XML: %v", err)
+	}
+
+	if doc.Tests != 4 || doc.Failures != 2 {
+		t.Errorf("tests/failures = %d/%d, want 4/2", doc.Tests, doc.Failures)
+	}
+
+	files := doc.Suites[0].TestCases
+	if files[0].Name != "kv-files/a.yaml" || files[0].Failure == nil || files[1].Failure != nil {
+		t.Errorf("file test cases = %+v", files)
+	}
+
+	batch := doc.Suites[1].TestCases[1]
+	if batch.Failure == nil || !strings.Contains(batch.Failure.Text, "Source: kv-files/b.yaml:4") {
+		t.Errorf("batch test case = %+v", batch)
+	}
+}
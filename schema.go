@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// validateSchemas validates the keys of the sources against the JSON Schemas of the environment.
+// The files are merged into one tree in which every value keeps the type it was written with,
+// and every violation is reported at the line of the offending key. Values of pairs changed by
+// interpolation are validated with the type YAML resolves for the result. When unresolved is set,
+// the pairs are not interpolated yet, so values with references are not checked.
+func validateSchemas(sources []*SourceFile, pairs []KVPair, refs SchemaRefs, configPath string, sensitive SensitiveRules, unresolved bool) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	slog.Debug("validating against schemas", "count", len(refs))
+
+	tree, keys := mergeSources(sources)
+
+	references := make(map[string]bool)
+	for _, pair := range pairs {
+		switch {
+		case pair.Template != "":
+			setSchemaValue(tree, pair.Key, schemaValue(resolveScalar(pair.Value)))
+		case unresolved && pair.ValueFile == "" && hasReference(pair.Value):
+			references[pair.Key] = true
+		}
+	}
+
+	var diagnostics []Diagnostic
+	for _, ref := range refs {
+		schema, err := compileSchema(configPath, ref)
+		if err != nil {
+			return err
+		}
+
+		var validationErr *jsonschema.ValidationError
+		if err := schema.Validate(lookupTree(tree, ref.Prefix)); errors.As(err, &validationErr) {
+			for _, diag := range schemaDiagnostics(validationErr, ref, configPath, keys, sensitive) {
+				if !hasReferenceAt(references, diag.Key) {
+					diagnostics = append(diagnostics, diag)
+				}
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to validate against schema %s: %w", ref.Path, err)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].File != diagnostics[j].File {
+			return diagnostics[i].File < diagnostics[j].File
+		}
+		if diagnostics[i].Line != diagnostics[j].Line {
+			return diagnostics[i].Line < diagnostics[j].Line
+		}
+		return diagnostics[i].Key < diagnostics[j].Key
+	})
+
+	return diagnosticListError("%d schema violations", diagnostics)
+}
+
+// resolveScalar returns the value YAML resolves for a plain scalar, e.g. an int for "80"
+func resolveScalar(value string) interface{} {
+	var resolved interface{}
+	if err := (&yaml.Node{Kind: yaml.ScalarNode, Value: value}).Decode(&resolved); err != nil {
+		return value
+	}
+	return resolved
+}
+
+// hasReferenceAt reports whether the value at key, or the value of the list key belongs to,
+// still contains references
+func hasReferenceAt(references map[string]bool, key string) bool {
+	for {
+		if references[key] {
+			return true
+		}
+
+		i := strings.LastIndex(key, "/")
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// compileSchema loads the schema of a reference. Paths are relative to the configuration file.
+func compileSchema(configPath string, ref SchemaRef) (*jsonschema.Schema, error) {
+	schemaPath := ref.Path
+	if !filepath.IsAbs(schemaPath) {
+		schemaPath = filepath.Join(filepath.Dir(configPath), schemaPath)
+	}
+
+	schema, err := jsonschema.NewCompiler().Compile(schemaPath)
+	if err != nil {
+		return nil, loadDiagnosticError(configPath, "load schema of", fmt.Errorf("line %d: %s: %w", ref.Line, ref.Path, err))
+	}
+	return schema, nil
+}
+
+// schemaDiagnostics returns a diagnostic for every violation that caused err. Violations of keys
+// that are not defined in any file, like missing required keys at the top, are reported at the
+// schema reference in the configuration file.
+func schemaDiagnostics(err *jsonschema.ValidationError, ref SchemaRef, configPath string, keys map[string]KeyInfo, sensitive SensitiveRules) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, violation := range schemaViolations(err) {
+		key := ref.Prefix
+		if pointer := pointerKey(violation.InstanceLocation); pointer != "" {
+			key = buildKey(ref.Prefix, pointer)
+		}
+
+		info, ok := locateKey(keys, key)
+		if !ok {
+			info = KeyInfo{File: configPath, Line: ref.Line}
+		}
+
+		// Some messages quote the value, e.g. for the format keyword
+		message := violation.Message
+		if info.Sensitive || sensitive.Match(key) {
+			message = fmt.Sprintf("value does not satisfy %q", path.Base(violation.KeywordLocation))
+		}
+
+		displayKey := key
+		if displayKey == "" {
+			displayKey = "/"
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Category: CategorySchema,
+			File:     info.File,
+			Line:     info.Line,
+			Key:      key,
+			Message:  fmt.Sprintf("%q: %s (%s)", displayKey, message, ref.Path),
+		})
+	}
+
+	return diagnostics
+}
+
+// schemaViolations returns the innermost errors of err, which describe the actual violations
+func schemaViolations(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	var violations []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		violations = append(violations, schemaViolations(cause)...)
+	}
+	return violations
+}
+
+// pointerKey converts a JSON pointer into the instance to a key path
+func pointerKey(pointer string) string {
+	if pointer == "" {
+		return ""
+	}
+
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segment = strings.ReplaceAll(segment, "~1", "/")
+		segments[i] = strings.ReplaceAll(segment, "~0", "~")
+	}
+	return strings.Join(segments, "/")
+}
+
+// locateKey returns where key, or the closest of its parents, is defined. Elements of lists are
+// located at the key of the list.
+func locateKey(keys map[string]KeyInfo, key string) (KeyInfo, bool) {
+	for {
+		if info, ok := keys[key]; ok {
+			return info, true
+		}
+
+		i := strings.LastIndex(key, "/")
+		if i < 0 {
+			return KeyInfo{}, false
+		}
+		key = key[:i]
+	}
+}
+
+// mergeSources merges the content of the sources into one tree and collects where every key is defined
+func mergeSources(sources []*SourceFile) (map[string]interface{}, map[string]KeyInfo) {
+	tree := make(map[string]interface{})
+	keys := make(map[string]KeyInfo)
+
+	for _, source := range sources {
+		mergeSchemaTree(tree, source.Content)
+		for _, key := range sortedKeys(source.Untagged) {
+			setSchemaValue(tree, key, schemaValue(source.Untagged[key]))
+		}
+		for key, info := range source.Keys {
+			if _, exists := keys[key]; !exists {
+				keys[key] = info
+			}
+		}
+	}
+
+	return tree, keys
+}
+
+// mergeSchemaTree merges src into dst, splitting keys that contain "/" so that every value is
+// nested like the Consul key it becomes
+func mergeSchemaTree(dst, src map[string]interface{}) {
+	for _, key := range sortedKeys(src) {
+		value := src[key]
+		segments := strings.Split(key, "/")
+
+		target := dst
+		for _, segment := range segments[:len(segments)-1] {
+			child, ok := target[segment].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				target[segment] = child
+			}
+			target = child
+		}
+
+		last := segments[len(segments)-1]
+		converted := schemaValue(value)
+		if child, ok := converted.(map[string]interface{}); ok {
+			existing, isMap := target[last].(map[string]interface{})
+			if !isMap {
+				existing = make(map[string]interface{})
+				target[last] = existing
+			}
+			mergeSchemaTree(existing, child)
+			continue
+		}
+		target[last] = converted
+	}
+}
+
+// setSchemaValue replaces the value at key in a tree built by mergeSchemaTree
+func setSchemaValue(tree map[string]interface{}, key string, value interface{}) {
+	segments := strings.Split(key, "/")
+	for _, segment := range segments[:len(segments)-1] {
+		child, ok := tree[segment].(map[string]interface{})
+		if !ok {
+			return
+		}
+		tree = child
+	}
+	tree[segments[len(segments)-1]] = value
+}
+
+// schemaValue converts a loaded value to the types a JSON Schema validates
+func schemaValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		tree := make(map[string]interface{})
+		mergeSchemaTree(tree, v)
+		return tree
+	case map[interface{}]interface{}:
+		return schemaValue(stringKeyMaps(v))
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = schemaValue(item)
+		}
+		return converted
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case nil, bool, string, int, int64, uint64, float64, json.Number:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// lookupTree returns the subtree below prefix, or nil when there is none
+func lookupTree(tree map[string]interface{}, prefix string) interface{} {
+	if prefix == "" {
+		return tree
+	}
+
+	var current interface{} = tree
+	for _, segment := range strings.Split(prefix, "/") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[segment]
+	}
+	return current
+}
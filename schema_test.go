@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+const testServerSchema = `{
+  "type": "object",
+  "required": ["port"],
+  "properties": {
+    "port": {"type": "integer", "minimum": 1, "maximum": 65535},
+    "hosts": {"type": "array", "items": {"type": "string", "format": "hostname"}},
+    "password": {"type": "string", "minLength": 12},
+    "enabled": {"type": "boolean"}
+  }
+}`
+
+func TestValidateSchemas(t *testing.T) {
+	t.Setenv("PORT", "80")
+	t.Setenv("PORT_NAME", "eighty")
+
+	tests := []struct {
+		name        string
+		files       map[string]string
+		refs        SchemaRefs
+		interpolate bool
+		unresolved  bool
+		want        []string // location and message of every violation
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    port: 8080\n    hosts: [a.example.com]\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+		},
+		{
+			name:  "wrong type",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    port: eighty\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			want:  []string{`app.yaml:3: "app/server/port": expected integer, but got string (server.json)`},
+		},
+		{
+			name: "across files and formats",
+			files: map[string]string{
+				"app.yaml":    "app:\n  name: myapp\n",
+				"values.json": "{\n  \"app/server\": {\n    \"port\": 70000\n  }\n}\n",
+			},
+			refs: SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			want: []string{`values.json:3: "app/server/port": must be <= 65535 but found 70000 (server.json)`},
+		},
+		{
+			name:  "list element",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    port: 80\n    hosts:\n      - a.example.com\n      - 1\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			want:  []string{`app.yaml:4: "app/server/hosts/1": expected string, but got number (server.json)`},
+		},
+		{
+			name:  "tagged numbers and booleans",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    port: !secret 8080\n    enabled: !flags:1 true\n    hosts: [!secret a.example.com]\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+		},
+		{
+			name:  "flagged number in a flagged subtree",
+			files: map[string]string{"app.yaml": "app:\n  server: !flags:2\n    port: !flags:1 0x1F90\n    enabled: false\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+		},
+		{
+			name:  "quoted tagged number",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    port: !flags:1 \"8080\"\n    enabled: !flags:1 yes\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			want: []string{
+				`app.yaml:3: "app/server/port": expected integer, but got string (server.json)`,
+				`app.yaml:4: "app/server/enabled": expected boolean, but got string (server.json)`,
+			},
+		},
+		{
+			name:  "missing prefix",
+			files: map[string]string{"app.yaml": "app:\n  name: myapp\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			want:  []string{`app.yaml:1: "app/server": expected object, but got null (server.json)`},
+		},
+		{
+			name:  "missing top-level key",
+			files: map[string]string{"app.yaml": "app:\n  name: myapp\n"},
+			refs:  SchemaRefs{{Prefix: "db", Path: "server.json", Line: 3}},
+			want:  []string{`environments.yaml:3: "db": expected object, but got null (server.json)`},
+		},
+		{
+			name:  "missing required key",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    hosts: []\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			want:  []string{`app.yaml:2: "app/server": missing properties: 'port' (server.json)`},
+		},
+		{
+			name:  "sensitive value",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    port: 80\n    password: hunter2\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			want:  []string{`app.yaml:4: "app/server/password": value does not satisfy "minLength" (server.json)`},
+		},
+		{
+			name:  "whole environment",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    port: 80\n"},
+			refs:  SchemaRefs{{Path: "root.json", Line: 2}},
+			want:  []string{`environments.yaml:2: "/": missing properties: 'db' (root.json)`},
+		},
+		{
+			name:        "interpolated integer",
+			files:       map[string]string{"app.yaml": "app:\n  server:\n    port: ${PORT}\n    enabled: ${ENABLED:-true}\n"},
+			refs:        SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			interpolate: true,
+		},
+		{
+			name:        "interpolated value of the wrong type",
+			files:       map[string]string{"app.yaml": "app:\n  server:\n    port: ${PORT_NAME}\n"},
+			refs:        SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			interpolate: true,
+			want:        []string{`app.yaml:3: "app/server/port": expected integer, but got string (server.json)`},
+		},
+		{
+			name:       "reference before interpolation",
+			files:      map[string]string{"app.yaml": "app:\n  server:\n    port: ${PORT}\n    hosts: [a.example.com, '${HOST}']\n"},
+			refs:       SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			unresolved: true,
+		},
+		{
+			name:  "reference without interpolation",
+			files: map[string]string{"app.yaml": "app:\n  server:\n    port: ${PORT}\n"},
+			refs:  SchemaRefs{{Prefix: "app/server", Path: "server.json", Line: 3}},
+			want:  []string{`app.yaml:3: "app/server/port": expected integer, but got string (server.json)`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, t.TempDir(), tt.files)
+			writeFiles(t, dir, map[string]string{
+				"server.json": testServerSchema,
+				"root.json":   `{"type": "object", "required": ["app", "db"]}`,
+			})
+
+			var paths []string
+			for name := range tt.files {
+				paths = append(paths, filepath.Join(dir, name))
+			}
+			sources, err := loadAllSourceFiles(fileEntries(paths...), LoadOptions{})
+			if err != nil {
+				t.Fatalf("loadAllSourceFiles() error = %v", err)
+			}
+
+			pairs := collectAllKVPairs(sources)
+			if tt.interpolate {
+				if err := interpolatePairs(pairs, false); err != nil {
+					t.Fatalf("interpolatePairs() error = %v", err)
+				}
+			}
+
+			err = validateSchemas(sources, pairs, tt.refs, filepath.Join(dir, "environments.yaml"), SensitiveRules{}, tt.unresolved)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("validateSchemas() error = %v", err)
+				}
+				return
+			}
+
+			var diagErr *DiagnosticError
+			if !errors.As(err, &diagErr) {
+				t.Fatalf("validateSchemas() error = %v, want a DiagnosticError", err)
+			}
+			var got []string
+			for _, diag := range diagErr.Diagnostics {
+				if diag.Category != CategorySchema {
+					t.Errorf("category = %s, want %s", diag.Category, CategorySchema)
+				}
+				got = append(got, formatLocation(filepath.Base(diag.File), diag.Line)+": "+diag.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateSchemasInvalidSchema(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{"broken.json": `{"type": 1}`})
+	configPath := filepath.Join(dir, "environments.yaml")
+
+	err := validateSchemas(nil, nil, SchemaRefs{{Path: "broken.json", Line: 4}}, configPath, SensitiveRules{}, false)
+	var diagErr *DiagnosticError
+	if !errors.As(err, &diagErr) || !strings.Contains(err.Error(), "line 4: broken.json") {
+		t.Fatalf("validateSchemas() error = %v", err)
+	}
+	if diag := diagErr.Diagnostics[0]; diag.Category != CategoryLoad || diag.Line != 4 {
+		t.Errorf("diagnostic = %+v", diag)
+	}
+
+	err = validateSchemas(nil, nil, SchemaRefs{{Path: "missing.json", Line: 2}}, configPath, SensitiveRules{}, false)
+	if err == nil || !strings.Contains(err.Error(), "line 2: missing.json") {
+		t.Errorf("validateSchemas() with a missing schema error = %v", err)
+	}
+}
+
+func TestSchemaRefsUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    SchemaRefs
+		wantErr string
+	}{
+		{
+			name:    "single schema",
+			content: "files: [a.yaml]\nschema: schemas/all.json\n",
+			want:    SchemaRefs{{Path: "schemas/all.json", Line: 2}},
+		},
+		{
+			name:    "prefixes",
+			content: "files: [a.yaml]\nschema:\n  /: schemas/all.json\n  app/server/: schemas/server.json\n",
+			want: SchemaRefs{
+				{Path: "schemas/all.json", Line: 3},
+				{Prefix: "app/server", Path: "schemas/server.json", Line: 4},
+			},
+		},
+		{name: "list", content: "files: [a.yaml]\nschema: [a.json]\n", wantErr: "line 2: schema must be a file path or a mapping"},
+		{name: "empty path", content: "files: [a.yaml]\nschema:\n  app: \"\"\n", wantErr: "line 3: schema of 'app' expects a file path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var env Environment
+			err := yaml.Unmarshal([]byte(tt.content), &env)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Unmarshal() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if len(env.Schema) != len(tt.want) {
+				t.Fatalf("Schema = %+v, want %+v", env.Schema, tt.want)
+			}
+			for i := range tt.want {
+				if env.Schema[i] != tt.want[i] {
+					t.Errorf("Schema[%d] = %+v, want %+v", i, env.Schema[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSchemasDecryptedValues(t *testing.T) {
+	setAgeIdentity(t, testAgeIdentity)
+	identity, err := age.ParseX25519Identity(testAgeIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sopsTestDocument holds app/db/port as an int and app/db/password as a string
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"secrets.yaml": sopsTestDocument,
+		"server.yaml": "server:\n  port: " + encryptedTagValue(t, identity.Recipient(), "8080", "    ") +
+			"\n  enabled: " + encryptedTagValue(t, identity.Recipient(), "true", "    ") + "\n",
+		"db.json":     `{"type": "object", "properties": {"port": {"type": "integer"}, "password": {"type": "string"}}}`,
+		"server.json": testServerSchema,
+	})
+
+	sources, err := loadAllSourceFiles(fileEntries(filepath.Join(dir, "secrets.yaml"), filepath.Join(dir, "server.yaml")), LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadAllSourceFiles() error = %v", err)
+	}
+
+	refs := SchemaRefs{{Prefix: "app/db", Path: "db.json", Line: 2}, {Prefix: "server", Path: "server.json", Line: 3}}
+	if err := validateSchemas(sources, nil, refs, filepath.Join(dir, "environments.yaml"), SensitiveRules{}, false); err != nil {
+		t.Errorf("validateSchemas() error = %v", err)
+	}
+}
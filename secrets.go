@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// RedactedValue replaces sensitive values in every report
+	RedactedValue = "<redacted>"
+
+	// SecretTag marks a YAML value, or a whole subtree, as sensitive
+	SecretTag = "!secret"
+)
+
+// sensitiveKeyNames are looked for anywhere in the last segment of every key, like *password*
+var sensitiveKeyNames = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"apikey",
+	"api_key",
+	"private_key",
+	"credential",
+}
+
+// SensitiveRules decides which keys hold sensitive values
+type SensitiveRules struct {
+	Patterns []string
+}
+
+// Match reports whether the key matches one of the configured patterns or looks like a secret by name
+func (r SensitiveRules) Match(key string) bool {
+	for _, pattern := range r.Patterns {
+		if matchKeyPattern(pattern, key) {
+			return true
+		}
+	}
+
+	name := strings.ToLower(key[strings.LastIndex(key, "/")+1:])
+	name = strings.ReplaceAll(name, "-", "_")
+	for _, sensitive := range sensitiveKeyNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// markSensitivePairs flags every pair whose key matches the rules; pairs already flagged stay flagged
+func markSensitivePairs(pairs []KVPair, rules SensitiveRules) {
+	for i := range pairs {
+		if !pairs[i].Sensitive && rules.Match(pairs[i].Key) {
+			pairs[i].Sensitive = true
+		}
+	}
+}
+
+// markSensitiveDuplicates flags every definition of a duplicate key that matches the rules
+func markSensitiveDuplicates(duplicates []DuplicateInfo, rules SensitiveRules) {
+	for i := range duplicates {
+		if !rules.Match(duplicates[i].Key) {
+			continue
+		}
+		for j := range duplicates[i].Files {
+			duplicates[i].Files[j].Sensitive = true
+		}
+	}
+}
+
+// isSecretNode reports whether a YAML value is tagged !secret. Lists are stored as a single
+// value, so a list is secret as soon as one of its items is.
+func isSecretNode(node *yaml.Node) bool {
+	if node.Tag == SecretTag {
+		return true
+	}
+
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			if isSecretNode(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// displayValue returns the value as it may be shown in human or machine output.
+// Binary values are summarized by their size.
+func displayValue(value string, sensitive bool) string {
+	if sensitive {
+		return RedactedValue
+	}
+	if !utf8.ValidString(value) {
+		return fmt.Sprintf("<binary, %d bytes>", len(value))
+	}
+	return value
+}
+
+// matchKeyPattern matches a key against a glob pattern. "*" and the other path.Match
+// wildcards stay within one segment, "**" matches any number of segments.
+func matchKeyPattern(pattern, key string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(key, "/"))
+}
+
+func matchSegments(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(key); i++ {
+			if matchSegments(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(key) == 0 {
+		return false
+	}
+
+	if ok, err := path.Match(pattern[0], key[0]); err != nil || !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], key[1:])
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSensitiveRulesMatch(t *testing.T) {
+	rules := SensitiveRules{Patterns: []string{"production/database/*", "**/signing/**"}}
+
+	tests := []struct {
+		key      string
+		expected bool
+	}{
+		{"production/database/host", true},
+		{"production/database/replica/host", false},
+		{"app/signing/keys/current", true},
+		{"signing/key", true},
+		{"app/database/password", true},
+		{"app/DB_PASSWORD", true},
+		{"app/github-token", true},
+		{"app/api_key", true},
+		{"app/secrets/host", false},
+		{"app/csrf/token_length", true},
+		{"db/password_old", true},
+		{"db/passwordFile", true},
+		{"db/admin_password", true},
+		{"db/passport", false},
+		{"app/aws/secret_key", true},
+		{"app/name", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := rules.Match(tt.key); got != tt.expected {
+				t.Errorf("Match(%q) = %v, want %v", tt.key, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadYAMLFileSecretTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	content := `app:
+  name: myapp
+  dsn: !secret postgres://user:pass@db/app
+  tls: !secret
+    cert: cert-data
+    key: key-data
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadSourceFile(path, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loadSourceFile() error = %v", err)
+	}
+
+	expected := map[string]KVPair{
+		"app/name":     {Value: "myapp"},
+		"app/dsn":      {Value: "postgres://user:pass@db/app", Sensitive: true},
+		"app/tls/cert": {Value: "cert-data", Sensitive: true},
+		"app/tls/key":  {Value: "key-data", Sensitive: true},
+	}
+
+	pairs := collectAllKVPairs([]*SourceFile{source})
+	if len(pairs) != len(expected) {
+		t.Fatalf("got %d pairs, want %d", len(pairs), len(expected))
+	}
+	for _, pair := range pairs {
+		want := expected[pair.Key]
+		if pair.Value != want.Value || pair.Sensitive != want.Sensitive {
+			t.Errorf("pair %s = (%q, sensitive=%v), want (%q, sensitive=%v)",
+				pair.Key, pair.Value, pair.Sensitive, want.Value, want.Sensitive)
+		}
+	}
+}
+
+func TestSensitiveValuesAreRedacted(t *testing.T) {
+	secret := "hunter2"
+	pairs := []KVPair{
+		{Key: "app/name", Value: "myapp"},
+		{Key: "app/db/password", Value: secret, File: "app.yaml", Line: 4},
+	}
+	markSensitivePairs(pairs, SensitiveRules{})
+
+	duplicates := []DuplicateInfo{{
+		Key: "app/db/password",
+		Files: []FileSource{
+			{Filename: "a.yaml", Line: 1, Value: secret},
+			{Filename: "b.yaml", Line: 2, Value: secret},
+		},
+	}}
+	markSensitiveDuplicates(duplicates, SensitiveRules{})
+
+	drift := compareKeySpace(pairs, []KVPair{{Key: "app/name", Value: "myapp"}, {Key: "app/db/password", Value: "old"}}, false)
+
+	summary := &ExecutionSummary{
+		TotalBatches:  1,
+		FailedBatches: 1,
+		Results: []BatchResult{{
+			Pairs:    pairs,
+			OpErrors: []TxnError{{OpIndex: 1, What: "rejected"}},
+		}},
+	}
+	var jsonOutput strings.Builder
+	if err := writeExecutionSummary(&jsonOutput, summary, OutputJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := map[string]string{
+		"display":   formatKVPairsForDisplay(pairs),
+		"duplicate": formatDuplicateError(duplicates),
+		"drift":     formatDriftReport(drift),
+		"summary":   formatExecutionSummary(summary),
+		"json":      jsonOutput.String(),
+	}
+	for name, output := range outputs {
+		if strings.Contains(output, secret) || strings.Contains(output, "old") {
+			t.Errorf("%s output leaks the secret:\n%s", name, output)
+		}
+		// The JSON encoder escapes the angle brackets
+		if !strings.Contains(output, "redacted") {
+			t.Errorf("%s output does not contain %q:\n%s", name, RedactedValue, output)
+		}
+	}
+
+	// Redaction only affects output, the value itself is still synced
+	ops := createTransactionOps(pairs)
+	if ops[1].KV.Value != encodeValue(secret) {
+		t.Errorf("transaction value = %q, want %q", ops[1].KV.Value, encodeValue(secret))
+	}
+}
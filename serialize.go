@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// JSONTag stores a YAML subtree as a single JSON value instead of flattening it
+	JSONTag = "!json"
+
+	// YAMLTag stores a YAML subtree as a single YAML value instead of flattening it
+	YAMLTag = "!yaml"
+)
+
+// DocumentRules lists the key patterns whose subtrees are stored as a single JSON or YAML value
+type DocumentRules struct {
+	JSON []string
+	YAML []string
+}
+
+// format returns the format the subtree of key is stored in, if any
+func (r DocumentRules) format(key string) (string, bool) {
+	for _, pattern := range r.JSON {
+		if matchKeyPattern(pattern, key) {
+			return FormatJSON, true
+		}
+	}
+	for _, pattern := range r.YAML {
+		if matchKeyPattern(pattern, key) {
+			return FormatYAML, true
+		}
+	}
+	return "", false
+}
+
+// documentTagFormat returns the format a value tagged !json or !yaml is stored in
+func documentTagFormat(node *yaml.Node) (string, bool) {
+	switch node.Tag {
+	case JSONTag:
+		return FormatJSON, true
+	case YAMLTag:
+		return FormatYAML, true
+	default:
+		return "", false
+	}
+}
+
+// encodeDocumentKeys replaces the subtrees of keys tagged !json or !yaml, or matching the rules,
+// with their serialized form. The key then holds a single value that is sensitive when any key
+// below it is.
+func encodeDocumentKeys(sources []*SourceFile, rules DocumentRules, sensitive SensitiveRules) error {
+	for _, source := range sources {
+		if err := source.encodeDocuments(source.Content, "", rules, sensitive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SourceFile) encodeDocuments(content map[string]interface{}, prefix string, rules DocumentRules, sensitive SensitiveRules) error {
+	for _, key := range sortedKeys(content) {
+		fullKey := buildKey(prefix, key)
+		value := content[key]
+
+		format, ok := s.Documents[fullKey]
+		if !ok {
+			format, ok = rules.format(fullKey)
+		}
+		if !ok || !isDocumentValue(value) {
+			if child, isMap := value.(map[string]interface{}); isMap {
+				if err := s.encodeDocuments(child, fullKey, rules, sensitive); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		encoded, err := encodeDocumentValue(value, format)
+		if err != nil {
+			return loadDiagnosticError(s.Path, "encode", fmt.Errorf("line %d: %s: %w", keyLine(s.Keys, fullKey), fullKey, err))
+		}
+
+		info := s.keyInfo(fullKey)
+		for _, pair := range processValue(fullKey, value) {
+			if s.keyInfo(pair.Key).Sensitive || sensitive.Match(pair.Key) {
+				info.Sensitive = true
+			}
+		}
+		content[key] = encoded
+		s.Keys[fullKey] = info
+	}
+
+	return nil
+}
+
+// isDocumentValue reports whether a value would otherwise be split into several keys or
+// stored in the %v form of a list
+func isDocumentValue(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// encodeDocumentValue serializes a value as compact JSON or as YAML. Map keys are written
+// in sorted order, so the same content always gives the same value.
+func encodeDocumentValue(value interface{}, format string) (string, error) {
+	value = stringKeyMaps(value)
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			return "", fmt.Errorf("failed to encode JSON: %w", err)
+		}
+	case FormatYAML:
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return "", fmt.Errorf("failed to encode YAML: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("unsupported document format '%s'", format)
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// stringKeyMaps converts maps with non-string keys, which JSON cannot represent, to string keys
+func stringKeyMaps(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = stringKeyMaps(item)
+		}
+		return converted
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[mapKeyString(key)] = stringKeyMaps(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = stringKeyMaps(item)
+		}
+		return converted
+	default:
+		return value
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeDocumentKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		rules     DocumentRules
+		sensitive SensitiveRules
+		expected  map[string]KVPair
+	}{
+		{
+			name: "tagged values",
+			files: map[string]string{"app.yaml": `app:
+  name: myapp
+  config: !json
+    timeout: 30
+    hosts: [b, a]
+    url: "http://example.com/?a=1&b=<2>"
+  rules: !yaml
+    - name: one
+      allow: true
+  auth: !json
+    user: admin
+    password: !secret hunter2
+  empty: !json {}
+`},
+			expected: map[string]KVPair{
+				"app/name":   {Value: "myapp", Line: 2},
+				"app/config": {Value: `{"hosts":["b","a"],"timeout":30,"url":"http://example.com/?a=1&b=<2>"}`, Line: 3},
+				"app/rules":  {Value: "- allow: true\n  name: one", Line: 7},
+				"app/auth":   {Value: `{"password":"hunter2","user":"admin"}`, Line: 10, Sensitive: true},
+				"app/empty":  {Value: `{}`, Line: 13},
+			},
+		},
+		{
+			name: "tag below a prefix",
+			files: map[string]string{"app.yaml": `# kv-prefix: services/api
+limits: !json
+  cpu: 2
+`},
+			expected: map[string]KVPair{
+				"services/api/limits": {Value: `{"cpu":2}`, Line: 2},
+			},
+		},
+		{
+			name: "environment rules",
+			files: map[string]string{"app.json": `{
+  "services": {
+    "api": {"features": {"b": true, "a": false}},
+    "worker": {"features": {"c": true}, "db": {"user": "app", "password": "x"}}
+  },
+  "plain": "value"
+}
+`},
+			rules: DocumentRules{JSON: []string{"services/*/features"}, YAML: []string{"services/worker/db"}},
+			expected: map[string]KVPair{
+				"services/api/features":    {Value: `{"a":false,"b":true}`, Line: 3},
+				"services/worker/features": {Value: `{"c":true}`, Line: 4},
+				"services/worker/db":       {Value: "password: x\nuser: app", Line: 4, Sensitive: true},
+				"plain":                    {Value: "value", Line: 6},
+			},
+		},
+		{
+			name:      "sensitive_keys patterns below an encoded key",
+			files:     map[string]string{"app.yaml": "db: !yaml\n  user: app\n  host: db.local\n"},
+			sensitive: SensitiveRules{Patterns: []string{"db/user"}},
+			expected: map[string]KVPair{
+				"db": {Value: "host: db.local\nuser: app", Line: 1, Sensitive: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, t.TempDir(), tt.files)
+
+			var paths []string
+			for name := range tt.files {
+				paths = append(paths, filepath.Join(dir, name))
+			}
+			sources, err := loadAllSourceFiles(fileEntries(paths...), LoadOptions{})
+			if err != nil {
+				t.Fatalf("loadAllSourceFiles() error = %v", err)
+			}
+			if err := encodeDocumentKeys(sources, tt.rules, tt.sensitive); err != nil {
+				t.Fatalf("encodeDocumentKeys() error = %v", err)
+			}
+
+			pairs := collectAllKVPairs(sources)
+			if len(pairs) != len(tt.expected) {
+				t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(tt.expected), pairs)
+			}
+			for _, pair := range pairs {
+				want, ok := tt.expected[pair.Key]
+				if !ok {
+					t.Errorf("unexpected key %s", pair.Key)
+					continue
+				}
+				if pair.Value != want.Value || pair.Line != want.Line || pair.Sensitive != want.Sensitive {
+					t.Errorf("%s = %q at line %d (sensitive %v), want %q at line %d (sensitive %v)",
+						pair.Key, pair.Value, pair.Line, pair.Sensitive, want.Value, want.Line, want.Sensitive)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeDocumentValueStable(t *testing.T) {
+	value := map[string]interface{}{
+		"z": 1,
+		"a": map[interface{}]interface{}{2: "two", "b": []interface{}{"x"}},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{FormatJSON, `{"a":{"2":"two","b":["x"]},"z":1}`},
+		{FormatYAML, "a:\n  \"2\": two\n  b:\n    - x\nz: 1"},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 5; i++ {
+			got, err := encodeDocumentValue(value, tt.format)
+			if err != nil {
+				t.Fatalf("encodeDocumentValue(%s) error = %v", tt.format, err)
+			}
+			if got != tt.expected {
+				t.Fatalf("encodeDocumentValue(%s) = %q, want %q", tt.format, got, tt.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateExtension marks files that are rendered with text/template before they are parsed
+const TemplateExtension = ".tmpl"
+
+// templateFuncs are the helpers available in templates in addition to the text/template builtins
+var templateFuncs = template.FuncMap{
+	"default": templateDefault,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"b64enc":  func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"quote":   func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+}
+
+// isTemplateFile reports whether the file is a template, e.g. app.yaml.tmpl
+func isTemplateFile(filePath string) bool {
+	return strings.HasSuffix(filePath, TemplateExtension)
+}
+
+// renderTemplateFile renders a template file with the environment variables as data. Undefined
+// variables render as an empty string, or fail the load in strict mode.
+func renderTemplateFile(filePath string, variables map[string]interface{}, strict bool) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	tmpl, err := template.New(filepath.Base(filePath)).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, loadDiagnosticError(filePath, "parse template", err)
+	}
+
+	// Undefined references are found in the parse tree and defined as empty strings in a copy of
+	// the variables, so text/template does not write "<no value>" for them
+	root := copyTemplateValue(variables).(map[string]interface{})
+	walker := &templateWalker{text: string(data), root: root, reported: make(map[parse.Pos]bool)}
+	walker.walk(tmpl.Tree.Root, walker.root)
+
+	for _, ref := range walker.undefined {
+		if strict {
+			return nil, loadDiagnosticError(filePath, "render template",
+				fmt.Errorf("line %d: undefined variable '%s'", ref.line, ref.name))
+		}
+		slog.Warn("undefined template variable replaced with an empty string", "file", filePath, "line", ref.line, "variable", ref.name)
+	}
+
+	// Lookups the walker cannot see, like index or fields of unknown data, fail in strict mode.
+	// The builtin index ignores missingkey, so it is replaced by one that does not.
+	if strict {
+		tmpl.Option("missingkey=error").Funcs(template.FuncMap{"index": strictIndex})
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, root); err != nil {
+		return nil, loadDiagnosticError(filePath, "render template", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// templateReference is a variable a template uses without it being defined
+type templateReference struct {
+	name string
+	line int
+}
+
+// templateWalker finds the fields a template reads that are missing or null in its data, and defines
+// them as empty strings. It follows dot into with and range blocks over known data; blocks whose dot
+// cannot be determined from the variables are not checked. Fields in a branch guarded by an undefined
+// condition are optional: they are defined but not reported.
+type templateWalker struct {
+	text      string
+	root      map[string]interface{}
+	undefined []templateReference
+	reported  map[parse.Pos]bool
+	guarded   int
+}
+
+func (w *templateWalker) walk(node parse.Node, dot interface{}) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			w.walk(child, dot)
+		}
+	case *parse.ActionNode:
+		w.checkPipe(n.Pipe, dot, true)
+	case *parse.IfNode:
+		// Conditions may test variables that are not defined, which guards the fields of the branch
+		if w.checkPipe(n.Pipe, dot, false) {
+			w.guarded++
+			w.walk(n.List, dot)
+			w.guarded--
+		} else {
+			w.walk(n.List, dot)
+		}
+		w.walk(n.ElseList, dot)
+	case *parse.WithNode:
+		w.checkPipe(n.Pipe, dot, false)
+		if value, ok := w.pipeValue(n.Pipe, dot); ok {
+			w.walk(n.List, value)
+		}
+		w.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		w.checkPipe(n.Pipe, dot, false)
+		if value, ok := w.pipeValue(n.Pipe, dot); ok {
+			switch items := value.(type) {
+			case []interface{}:
+				for _, item := range items {
+					w.walk(n.List, item)
+				}
+			case map[string]interface{}:
+				for _, key := range sortedKeys(items) {
+					w.walk(n.List, items[key])
+				}
+			}
+		}
+		w.walk(n.ElseList, dot)
+	}
+}
+
+// checkPipe checks the fields used by a pipeline and reports whether any of them is undefined.
+// Undefined fields are reported when report is set and the pipeline supplies no default of its
+// own; otherwise, as in conditions, they are only defined as null.
+func (w *templateWalker) checkPipe(pipe *parse.PipeNode, dot interface{}, report bool) bool {
+	if pipe == nil {
+		return false
+	}
+	for _, cmd := range pipe.Cmds {
+		if len(cmd.Args) > 0 {
+			if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "default" {
+				report = false
+			}
+		}
+	}
+
+	undefined := false
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.FieldNode:
+				undefined = w.checkField(a, dot, a.Ident, report) || undefined
+			case *parse.VariableNode:
+				if a.Ident[0] == "$" && len(a.Ident) > 1 {
+					undefined = w.checkField(a, w.root, a.Ident[1:], report) || undefined
+				}
+			case *parse.PipeNode:
+				undefined = w.checkPipe(a, dot, report) || undefined
+			}
+		}
+	}
+	return undefined
+}
+
+// checkField reports whether a field is missing or null. A reported field is recorded and defined
+// as an empty string, any other one is defined as null so that a missing key is not an error.
+func (w *templateWalker) checkField(node parse.Node, dot interface{}, idents []string, report bool) bool {
+	current := dot
+	for i, ident := range idents {
+		fields, ok := current.(map[string]interface{})
+		if !ok {
+			// Not data from the variables, e.g. a method call, which text/template evaluates itself
+			return false
+		}
+
+		value := fields[ident]
+		if value == nil {
+			for _, child := range idents[i+1:] {
+				nested := make(map[string]interface{})
+				fields[ident] = nested
+				fields, ident = nested, child
+			}
+			if !report {
+				fields[ident] = nil
+				return true
+			}
+			fields[ident] = ""
+
+			if w.guarded == 0 && !w.reported[node.Position()] {
+				w.reported[node.Position()] = true
+				line := 1 + strings.Count(w.text[:node.Position()], "\n")
+				w.undefined = append(w.undefined, templateReference{name: strings.Join(idents, "."), line: line})
+			}
+			return true
+		}
+		current = value
+	}
+	return false
+}
+
+// pipeValue returns the value of a pipeline that reads a single field from the data
+func (w *templateWalker) pipeValue(pipe *parse.PipeNode, dot interface{}) (interface{}, bool) {
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return nil, false
+	}
+
+	var current interface{}
+	var idents []string
+	switch a := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return dot, true
+	case *parse.FieldNode:
+		current, idents = dot, a.Ident
+	case *parse.VariableNode:
+		if a.Ident[0] != "$" {
+			return nil, false
+		}
+		current, idents = w.root, a.Ident[1:]
+	default:
+		return nil, false
+	}
+
+	for _, ident := range idents {
+		fields, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = fields[ident]
+	}
+	return current, true
+}
+
+// copyTemplateValue copies the maps and lists of the variables, so undefined fields can be defined
+// without changing the environment
+func copyTemplateValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyTemplateValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyTemplateValue(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// strictIndex is the index builtin for strict mode: a key missing from a map is an error
+// instead of the zero value
+func strictIndex(item interface{}, indexes ...interface{}) (interface{}, error) {
+	current := reflect.ValueOf(item)
+	for _, index := range indexes {
+		for current.IsValid() && current.Kind() == reflect.Interface {
+			current = current.Elem()
+		}
+		if !current.IsValid() {
+			return nil, fmt.Errorf("index of untyped nil")
+		}
+
+		key := reflect.ValueOf(index)
+		switch current.Kind() {
+		case reflect.Map:
+			if !key.IsValid() || !key.Type().AssignableTo(current.Type().Key()) {
+				return nil, fmt.Errorf("value has type %T; should be %s", index, current.Type().Key())
+			}
+			value := current.MapIndex(key)
+			if !value.IsValid() {
+				return nil, fmt.Errorf("map has no entry for key %q", fmt.Sprint(index))
+			}
+			current = value
+		case reflect.Slice, reflect.Array, reflect.String:
+			if !key.IsValid() || !key.CanInt() {
+				return nil, fmt.Errorf("cannot index slice/array with type %T", index)
+			}
+			i := key.Int()
+			if i < 0 || int(i) >= current.Len() {
+				return nil, fmt.Errorf("index out of range: %d", i)
+			}
+			current = current.Index(int(i))
+		default:
+			return nil, fmt.Errorf("can't index item of type %s", current.Type())
+		}
+	}
+
+	if !current.IsValid() {
+		return nil, nil
+	}
+	return current.Interface(), nil
+}
+
+// templateDefault returns value, or fallback when value is undefined or empty:
+// {{ .replicas | default 1 }}
+func templateDefault(fallback, value interface{}) interface{} {
+	if value == nil {
+		return fallback
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return fallback
+		}
+	case reflect.Bool:
+		if !v.Bool() {
+			return fallback
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplateFile(t *testing.T) {
+	variables := map[string]interface{}{
+		"environment": "staging",
+		"replicas":    2,
+		"password":    "hunter2",
+		"empty":       "",
+		"marker":      "<no value>",
+		"nothing":     nil,
+		"db":          map[string]interface{}{"host": "db.internal"},
+		"hosts": []interface{}{
+			map[string]interface{}{"name": "a", "port": 80},
+			map[string]interface{}{"name": "b"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		strict   bool
+		expected string
+		wantErr  string
+		wantLine int
+	}{
+		{
+			name:     "variables and helpers",
+			template: "env: {{ .environment | upper }}\nreplicas: {{ .replicas }}\nsecret: {{ .password | b64enc }}\n",
+			expected: "env: STAGING\nreplicas: 2\nsecret: aHVudGVyMg==\n",
+		},
+		{
+			name:     "default for undefined and empty variables",
+			template: "a: {{ .missing | default 4 }}\nb: {{ .empty | default \"x\" }}\nc: {{ .replicas | default 9 }}\n",
+			strict:   true,
+			expected: "a: 4\nb: x\nc: 2\n",
+		},
+		{
+			name:     "undefined variable",
+			template: "a: 1\nb: {{ .missing }}\n",
+			expected: "a: 1\nb: \n",
+		},
+		{
+			name:     "undefined variable in strict mode",
+			template: "a: 1\nb: {{ .missing }}\n",
+			strict:   true,
+			wantErr:  "undefined variable",
+			wantLine: 2,
+		},
+		{
+			name:     "literal no value text is kept",
+			template: "a: \"<no value>\"\nb: {{ .marker }}\n",
+			strict:   true,
+			expected: "a: \"<no value>\"\nb: <no value>\n",
+		},
+		{
+			name:     "undefined nested and null variables",
+			template: "a: {{ .db.host }}\nb: {{ .db.port }}\nc: {{ .nothing }}\nd: {{ $.missing }}\n",
+			expected: "a: db.internal\nb: \nc: \nd: \n",
+		},
+		{
+			name:     "undefined field in range",
+			template: "{{ range .hosts }}- {{ .name }}:{{ .port }}\n{{ end }}",
+			expected: "- a:80\n- b:\n",
+		},
+		{
+			name:     "undefined field in range in strict mode",
+			template: "hosts:\n{{ range .hosts }}\n- {{ .name }}:{{ .port }}\n{{ end }}",
+			strict:   true,
+			wantErr:  "undefined variable 'port'",
+			wantLine: 3,
+		},
+		{
+			name:     "index of undefined key in strict mode",
+			template: "a: 1\nb: {{ index . \"missing\" }}\n",
+			strict:   true,
+			wantErr:  "map has no entry for key",
+			wantLine: 2,
+		},
+		{
+			name:     "index of undefined key",
+			template: "b: {{ index .db \"host\" }}\n",
+			strict:   true,
+			expected: "b: db.internal\n",
+		},
+		{
+			name:     "condition on undefined variable",
+			template: "{{ if .missing }}a: 1{{ else }}a: 2{{ end }}\n",
+			strict:   true,
+			expected: "a: 2\n",
+		},
+		{
+			name:     "undefined variable guarded by undefined condition",
+			template: "a: 1{{ if .flag }}\nb: {{ .other }}{{ end }}\n",
+			strict:   true,
+			expected: "a: 1\n",
+		},
+		{
+			name:     "undefined variable guarded by negated condition",
+			template: "{{ if not .flag }}b: {{ .other }}{{ end }}\n",
+			strict:   true,
+			expected: "b: \n",
+		},
+		{
+			name:     "undefined variable in else branch of undefined condition",
+			template: "a: 1\n{{ if .flag }}{{ else }}b: {{ .other }}{{ end }}\n",
+			strict:   true,
+			wantErr:  "undefined variable 'other'",
+			wantLine: 2,
+		},
+		{
+			name:     "syntax error",
+			template: "a: 1\nb: {{ .replicas | nosuchfunc }}\n",
+			wantErr:  "failed to parse template",
+			wantLine: 2,
+		},
+		{
+			name:     "execution error",
+			template: "a: 1\n\nb: {{ .replicas | upper }}\n",
+			wantErr:  "failed to render template",
+			wantLine: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.yaml.tmpl")
+			if err := os.WriteFile(path, []byte(tt.template), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			rendered, err := renderTemplateFile(path, variables, tt.strict)
+			if tt.wantErr != "" {
+				var diagErr *DiagnosticError
+				if !errors.As(err, &diagErr) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("renderTemplateFile() error = %v, want %q", err, tt.wantErr)
+				}
+				if diagErr.Diagnostics[0].Line != tt.wantLine {
+					t.Errorf("diagnostic line = %d, want %d", diagErr.Diagnostics[0].Line, tt.wantLine)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderTemplateFile() error = %v", err)
+			}
+			if string(rendered) != tt.expected {
+				t.Errorf("rendered = %q, want %q", rendered, tt.expected)
+			}
+		})
+	}
+
+	if _, defined := variables["db"].(map[string]interface{})["port"]; defined {
+		t.Error("renderTemplateFile() defined an undefined variable in the environment's variables")
+	}
+}
+
+func TestLoadAllYAMLFilesTemplates(t *testing.T) {
+	dir := t.TempDir()
+	template := "workers:\n  replicas: {{ .replicas }}\n  queue: {{ .environment }}-jobs\n"
+	if err := os.WriteFile(filepath.Join(dir, "workers.yaml.tmpl"), []byte(template), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for environment, replicas := range map[string]string{"staging": "2", "production": "6"} {
+		opts := LoadOptions{Variables: map[string]interface{}{"environment": environment, "replicas": replicas}}
+
+		sources, err := loadAllSourceFiles(fileEntries(filepath.Join(dir, "workers.yaml.tmpl")), opts)
+		if err != nil {
+			t.Fatalf("loadAllSourceFiles() error = %v", err)
+		}
+
+		values := make(map[string]string)
+		for _, pair := range collectAllKVPairs(sources) {
+			values[pair.Key] = pair.Value
+		}
+		if values["workers/replicas"] != replicas || values["workers/queue"] != environment+"-jobs" {
+			t.Errorf("%s: got %v", environment, values)
+		}
+		if line := sources[0].Keys["workers/queue"].Line; line != 3 {
+			t.Errorf("%s: workers/queue line = %d, want 3", environment, line)
+		}
+	}
+}
@@ -1,14 +1,142 @@
 package main
 
+import (
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 // Config represents the environment configuration
 type Config struct {
-	Environments map[string][]string `yaml:",inline"`
+	Environments map[string]*Environment `yaml:",inline"`
+}
+
+// Environment represents the files and settings of a single environment
+type Environment struct {
+	Files           []FileEntry            `yaml:"files"`
+	SensitiveKeys   []string               `yaml:"sensitive_keys"`
+	Variables       map[string]interface{} `yaml:"variables"`
+	JSONDocuments   []string               `yaml:"json_documents"`
+	YAMLDocuments   []string               `yaml:"yaml_documents"`
+	FileValues      FileValues             `yaml:"file_values"`
+	Flags           FlagRules              `yaml:"flags"`
+	KeyRules        KeyRules               `yaml:"key_rules"`
+	AllowedPrefixes []string               `yaml:"allowed_prefixes"`
+	DeniedPrefixes  []string               `yaml:"denied_prefixes"`
+	Schema          SchemaRefs             `yaml:"schema"`
+}
+
+// SchemaRef validates the keys below a prefix against a JSON Schema file
+type SchemaRef struct {
+	Prefix string // empty for all keys of the environment
+	Path   string
+	Line   int // line of the reference in the configuration file
+}
+
+// SchemaRefs is the schema setting of an environment, either a single schema for all keys
+// or a mapping of prefix to schema
+type SchemaRefs []SchemaRef
+
+// KeyRules restricts the keys an environment may write, in addition to the checks that always apply
+type KeyRules struct {
+	Charset           string   `yaml:"charset"`            // Characters allowed in a segment, as the body of a regexp character class
+	MaxDepth          int      `yaml:"max_depth"`          // Maximum number of segments, 0 for no limit
+	MaxLength         int      `yaml:"max_length"`         // Maximum length in bytes, 0 for no limit
+	ForbiddenSegments []string `yaml:"forbidden_segments"` // Glob patterns of segments that may not be used
+
+	charset *regexp.Regexp
+}
+
+// FlagRule sets the Consul flags of every key matching a pattern
+type FlagRule struct {
+	Pattern string
+	Flags   uint64
+}
+
+// FlagRules is the flags mapping of key pattern to flags of an environment, in the order it is written
+type FlagRules []FlagRule
+
+// FileValue stores the content of a file as the value of a key
+type FileValue struct {
+	Key  string
+	Path string
+	Line int // line of the key in the configuration file
+}
+
+// FileValues is the file_values mapping of key to file of an environment, in the order it is written
+type FileValues []FileValue
+
+// FileEntry is a file listed for an environment, either as a plain path or as a mapping
+// that also sets the format the file is loaded as
+type FileEntry struct {
+	Path   string `yaml:"path"`
+	Format string `yaml:"format"`
+}
+
+// Options holds the settings for a single run of the tool
+type Options struct {
+	Environment string
+	ConfigFile  string
+	DryRun      bool
+	Export      bool
+	ConsulAddr  string
+	Datacenter  string
+	Backup      bool
+	BackupDir   string
+	Restore     string
+	Import      string
+	Pull        string
+	PullDir     string
+	Split       bool
+	Check       bool
+	CheckExtra  bool
+	Output      string
+	Interpolate bool
+	Strict      bool
+	MaxSize     int
+	MultiDoc    bool
+	Validate    bool
+	Reports     []ReportSpec
+}
+
+// LoadOptions controls how the files of an environment are loaded
+type LoadOptions struct {
+	Variables      map[string]interface{} // Data available to .tmpl files
+	Strict         bool                   // Fail on undefined template variables
+	SingleDocument bool                   // Reject files with more than one YAML document
+	Format         string                 // Format to load the file as instead of the one of its extension
 }
 
 // KVPair represents a key-value pair
 type KVPair struct {
-	Key   string
-	Value string
+	Key       string
+	Value     string
+	Flags     uint64
+	File      string
+	Line      int
+	Sensitive bool
+	Template  string // Value before interpolation, empty when the value had no references
+	ValueFile string // File the value was read from verbatim with !file or file_values
+}
+
+// SourceFile holds the content of a loaded file and where each of its keys is defined
+type SourceFile struct {
+	Path      string
+	Content   map[string]interface{}
+	Keys      map[string]KeyInfo
+	Documents map[string]string      // keys tagged !json or !yaml and the format they are stored in
+	Untagged  map[string]interface{} // keys whose tags like !secret keep their value a string, with the value YAML would resolve
+}
+
+// KeyInfo describes where a key path is defined
+type KeyInfo struct {
+	File      string
+	Line      int
+	Sensitive bool
+	ValueFile string
+	Flags     uint64
+	HasFlags  bool // Flags were set by a !flags:N tag and take precedence over flag rules
 }
 
 // TxnKVOp represents a KV operation in Consul transaction
@@ -45,6 +173,13 @@ type KVData struct {
 	ModifyIndex uint64 `json:"ModifyIndex"`
 }
 
+// ExportedKV represents a single entry of the Consul KV JSON export format
+type ExportedKV struct {
+	Key   string `json:"key"`
+	Flags uint64 `json:"flags,omitempty"`
+	Value string `json:"value"`
+}
+
 // TxnError represents an error in transaction
 type TxnError struct {
 	OpIndex int    `json:"OpIndex"`
@@ -59,8 +194,32 @@ type DuplicateInfo struct {
 
 // FileSource represents the source file and value of a key
 type FileSource struct {
-	Filename string
-	Value    interface{}
+	Filename  string
+	Line      int
+	Value     interface{}
+	Sensitive bool
+}
+
+// Diagnostic is a single problem found in the input or reported by Consul
+type Diagnostic struct {
+	Category string
+	File     string
+	Line     int
+	Key      string
+	Message  string
+}
+
+// ReportSpec is a single -report flag value, e.g. "junit=report.xml" or "github"
+type ReportSpec struct {
+	Format string
+	Path   string
+}
+
+// RunReport collects what a run did so it can be rendered as CI reports
+type RunReport struct {
+	Files       []string
+	Diagnostics []Diagnostic
+	Summary     *ExecutionSummary
 }
 
 // BatchResult represents the result of a batch operation
@@ -70,13 +229,73 @@ type BatchResult struct {
 	Error        error
 	OpErrors     []TxnError
 	ProcessedOps int
+	Interrupted  bool
+	Pairs        []KVPair
+	Duration     time.Duration
 }
 
 // ExecutionSummary represents the overall execution summary
 type ExecutionSummary struct {
 	TotalKeys      int
+	AddedKeys      int
+	ChangedKeys    int
+	SkippedKeys    int
+	CountsUnknown  bool // Consul could not be read before the sync; no key was skipped
 	TotalBatches   int
 	SuccessBatches int
 	FailedBatches  int
+	SkippedBatches int
+	Aborted        bool
+	AbortReason    string
 	Results        []BatchResult
+	StartedAt      time.Time
+	Duration       time.Duration
+}
+
+// SyncPlan splits the desired KV pairs by how they relate to the values already in Consul
+type SyncPlan struct {
+	Added     []KVPair
+	Changed   []KVPair
+	Unchanged []KVPair
+	Pending   []KVPair // Added and Changed pairs in their original order
+	Unknown   bool     // Consul could not be read; every pair is Pending and the others are empty
+}
+
+// DriftReport lists the differences between the desired KV pairs and Consul
+type DriftReport struct {
+	Missing []KVPair
+	Changed []DriftChange
+	Extra   []KVPair
+}
+
+// DriftChange represents a key whose value in Consul differs from the desired value
+type DriftChange struct {
+	Key           string
+	Expected      string
+	Actual        string
+	ExpectedFlags uint64
+	ActualFlags   uint64
+	Sensitive     bool
+}
+
+// SOPSMetadata is the part of the sops section of an encrypted file needed to decrypt it
+type SOPSMetadata struct {
+	Age              []SOPSAgeKey `yaml:"age"`
+	PGP              []SOPSPGPKey `yaml:"pgp"`
+	KeyGroups        []yaml.Node  `yaml:"key_groups"`
+	LastModified     string       `yaml:"lastmodified"`
+	MAC              string       `yaml:"mac"`
+	MACOnlyEncrypted bool         `yaml:"mac_only_encrypted"`
+}
+
+// SOPSAgeKey is the data key encrypted to one age recipient
+type SOPSAgeKey struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+// SOPSPGPKey is the data key encrypted to one PGP key
+type SOPSPGPKey struct {
+	Fingerprint string `yaml:"fp"`
+	Enc         string `yaml:"enc"`
 }